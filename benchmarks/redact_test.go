@@ -0,0 +1,104 @@
+package benchmarks
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/internal/testdata"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// generateSecrets creates n arbitrary literal secrets that do not occur in the generated
+// test input.
+func generateSecrets(n int) []string {
+	secrets := make([]string, n)
+	for i := range secrets {
+		secrets[i] = fmt.Sprintf("s3cr3t-%08x-token", i*2654435761)
+	}
+	return secrets
+}
+
+// BenchmarkRedactSecrets compares pipeline.Redact, which matches literal secrets with
+// Aho-Corasick, against naively searching for each secret in each line. Pipelines are
+// built before the timer starts - see BenchmarkRedactBuild for the cost of building them.
+func BenchmarkRedactSecrets(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		secrets := generateSecrets(n)
+
+		b.Run(fmt.Sprintf("Redact/%d", n), func(b *testing.B) {
+			input, reset := testdata.GenerateInput()
+			redact := pipeline.Redact(pipeline.RedactOptions{
+				Detectors: []pipeline.Detector{},
+				Secrets:   secrets,
+			})
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				reset()
+
+				s := streamline.New(input).WithPipeline(redact)
+				err := s.StreamBytes(func(_ []byte) error { return nil })
+				assert.NoError(b, err)
+			}
+		})
+
+		b.Run(fmt.Sprintf("Naive/%d", n), func(b *testing.B) {
+			input, reset := testdata.GenerateInput()
+			secretBytes := make([][]byte, len(secrets))
+			for i, s := range secrets {
+				secretBytes[i] = []byte(s)
+			}
+			naive := pipeline.Map(func(line []byte) []byte {
+				for _, secret := range secretBytes {
+					if bytes.Contains(line, secret) {
+						line = bytes.ReplaceAll(line, secret, []byte("[REDACTED]"))
+					}
+				}
+				return line
+			})
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				reset()
+
+				s := streamline.New(input).WithPipeline(naive)
+				err := s.StreamBytes(func(_ []byte) error { return nil })
+				assert.NoError(b, err)
+			}
+		})
+	}
+}
+
+// BenchmarkRedactBuild measures the cost of building a pipeline.Redact for literal
+// secrets, which builds an Aho-Corasick automaton.
+func BenchmarkRedactBuild(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		secrets := generateSecrets(n)
+
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = pipeline.Redact(pipeline.RedactOptions{
+					Detectors: []pipeline.Detector{},
+					Secrets:   secrets,
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkRedactDefaultDetectors(b *testing.B) {
+	input, reset := testdata.GenerateInput()
+	redact := pipeline.Redact(pipeline.RedactOptions{})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reset()
+
+		s := streamline.New(input).WithPipeline(redact)
+		err := s.StreamBytes(func(_ []byte) error { return nil })
+		assert.NoError(b, err)
+	}
+}
@@ -0,0 +1,244 @@
+// Command streamline transforms data line by line with the pipelines provided by
+// go.bobheadxi.dev/streamline, reading from files, standard input, or the output of a
+// command.
+//
+// Usage:
+//
+//	streamline [flags] [FILE...]
+//	streamline run [flags] -- COMMAND [ARGS...]
+//
+// Stages provided as flags are applied in the order they are given. For example:
+//
+//	streamline -grep ERROR -jq .msg -head 10 ./logs.json
+//	streamline run -e 'grep -v DEBUG | timestamp relative' -- make build
+//
+// When running a command, streamline exits with the command's exit code, or 128 plus
+// the signal number if the command was terminated by a signal.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/dsl"
+	"go.bobheadxi.dev/streamline/pipeline"
+	"go.bobheadxi.dev/streamline/streamexec"
+)
+
+// Exit codes used by streamline, in addition to exit codes propagated from commands.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 127
+	exitSignal   = 128
+)
+
+const usage = `Usage:
+  streamline [flags] [FILE...]
+  streamline run [flags] -- COMMAND [ARGS...]
+
+Reads lines from each FILE, or standard input if no files are provided, or the output
+of COMMAND, and writes them to standard output after applying the configured stages.
+Stages are applied in the order they are provided.
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes streamline with the given arguments and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	runCommand := len(args) > 0 && args[0] == "run"
+	if runCommand {
+		args = args[1:]
+	}
+
+	var stages stageFlags
+	flags := flag.NewFlagSet("streamline", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Var(stages.expression(), "e", "apply a pipeline `expression`, e.g. 'grep ERROR | jq .msg'")
+	flags.Var(stages.stage("grep"), "grep", "retain lines matching the regular expression `pattern`")
+	flags.Var(stages.stage("grep", "-v"), "grep-v", "omit lines matching the regular expression `pattern`")
+	flags.Var(stages.stage("sample"), "sample", "retain every `n`th line")
+	flags.Var(stages.stage("head"), "head", "retain only the first `n` lines")
+	flags.Var(stages.stage("jq"), "jq", "map JSON lines to the output of a jq `query`")
+	flags.Var(stages.stage("template"), "map", "map JSON lines with a Go text/template `template`")
+	streamMode := flags.String("stream", "combined",
+		"with 'run', the command output to stream: 'combined', 'stdout', or 'stderr'")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	// Stages are validated as flags are parsed, so this should not error.
+	p, err := dsl.DefaultRegistry().Build(&dsl.Expression{Stages: stages})
+	if err != nil {
+		fmt.Fprintf(stderr, "streamline: %s\n", err.Error())
+		return exitUsage
+	}
+
+	if runCommand {
+		return runCmd(flags.Args(), *streamMode, p, stdin, stdout, stderr)
+	}
+	return runFiles(flags.Args(), p, stdin, stdout, stderr)
+}
+
+// runFiles streams each file, or stdin if no files are provided, to stdout.
+func runFiles(files []string, p pipeline.Pipeline, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, file := range files {
+		// Each file is a separate stream so that a missing trailing newline in one file
+		// does not join its last line with the first line of the next file, but the
+		// same pipeline is used so that stages like head apply across all files.
+		if err := runFile(file, p, stdin, stdout); err != nil {
+			fmt.Fprintf(stderr, "streamline: %s\n", err.Error())
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// runFile streams file, or stdin if file is "-", to stdout. The file is closed before
+// runFile returns.
+func runFile(file string, p pipeline.Pipeline, stdin io.Reader, stdout io.Writer) error {
+	input := stdin
+	if file == "-" {
+		file = "stdin"
+	} else {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+	if _, err := streamline.New(input).WithPipeline(p).WriteTo(stdout); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// runCmd runs the command and streams its output to stdout, returning the command's exit
+// code.
+func runCmd(args []string, streamMode string, p pipeline.Pipeline, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "streamline: run: no command provided")
+		return exitUsage
+	}
+
+	var mode streamexec.StreamMode
+	switch streamMode {
+	case "combined":
+		mode = streamexec.Combined
+	case "stdout":
+		mode = streamexec.Stdout
+	case "stderr":
+		mode = streamexec.Stderr
+	default:
+		fmt.Fprintf(stderr, "streamline: run: invalid -stream %q\n", streamMode)
+		return exitUsage
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = stdin
+	// Output that is not streamed is passed through unmodified.
+	if mode&streamexec.Stdout == 0 {
+		cmd.Stdout = stdout
+	}
+	if mode&streamexec.Stderr == 0 {
+		cmd.Stderr = stderr
+	}
+
+	stream, err := streamexec.Start(cmd, mode)
+	if err != nil {
+		fmt.Fprintf(stderr, "streamline: run: %s\n", err.Error())
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return exitNotFound
+		}
+		return exitError
+	}
+
+	if _, err := stream.WithPipeline(p).WriteTo(stdout); err != nil {
+		var exitErr *streamexec.ExitError
+		if errors.As(err, &exitErr) {
+			// Like shells, report commands terminated by a signal with 128+signal.
+			if sig, ok := exitErr.Signal.(syscall.Signal); ok {
+				return exitSignal + int(sig)
+			}
+			if exitErr.ExitCode > 0 {
+				return exitErr.ExitCode
+			}
+		}
+		fmt.Fprintf(stderr, "streamline: run: %s\n", err.Error())
+		return exitError
+	}
+	return exitOK
+}
+
+// stageFlags collects stages from flags in the order they are provided.
+type stageFlags []dsl.Stage
+
+// stage returns a flag.Value that adds the named stage with the flag's value as the
+// last argument, after the given leading arguments.
+func (s *stageFlags) stage(name string, leadingArgs ...string) flag.Value {
+	return stageFlag(func(value string) error {
+		stage := dsl.Stage{Name: name}
+		for _, arg := range append(leadingArgs, value) {
+			stage.Args = append(stage.Args, dsl.Arg{Value: arg})
+		}
+		if _, err := dsl.DefaultRegistry().Build(&dsl.Expression{Stages: []dsl.Stage{stage}}); err != nil {
+			var dslErr *dsl.Error
+			if errors.As(err, &dslErr) {
+				return errors.New(dslErr.Message)
+			}
+			return err
+		}
+		*s = append(*s, stage)
+		return nil
+	})
+}
+
+// expression returns a flag.Value that adds all the stages of a pipeline expression.
+func (s *stageFlags) expression() flag.Value {
+	return stageFlag(func(value string) error {
+		// Validate the expression early so that errors can be reported with the position
+		// in the expression.
+		expr, err := dsl.Parse(value)
+		if err == nil {
+			_, err = dsl.DefaultRegistry().Build(expr)
+		}
+		if err != nil {
+			var dslErr *dsl.Error
+			if errors.As(err, &dslErr) {
+				return fmt.Errorf("%s\n%s", err.Error(), dslErr.Pointer())
+			}
+			return err
+		}
+		*s = append(*s, expr.Stages...)
+		return nil
+	})
+}
+
+// stageFlag implements flag.Value with a callback.
+type stageFlag func(value string) error
+
+func (f stageFlag) Set(value string) error { return f(value) }
+
+func (f stageFlag) String() string { return "" }
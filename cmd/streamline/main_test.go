@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline/dsl"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// binary is the path to the streamline binary built for end-to-end tests.
+var binary string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	dir, err := os.MkdirTemp("", "streamline-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	binary = filepath.Join(dir, "streamline")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build streamline: %s\n%s", err.Error(), string(out))
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// TestEndToEnd runs the streamline binary against the inputs in testdata, and compares
+// the results to golden files in testdata/golden. Run with -update to update the golden
+// files.
+func TestEndToEnd(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		stdin string
+	}{
+		{
+			name:  "stdin passthrough",
+			stdin: "hello\nworld\n",
+		},
+		{
+			name: "files",
+			args: []string{"testdata/plain.txt", "testdata/plain.txt"},
+		},
+		{
+			name: "ordered flags",
+			args: []string{"-grep", "error|info", "-jq", ".msg", "-head", "3", "testdata/logs.jsonl"},
+		},
+		{
+			name: "head across files",
+			args: []string{"-head", "4", "testdata/plain.txt", "testdata/plain.txt"},
+		},
+		{
+			name: "grep-v and sample",
+			args: []string{"-grep-v", "debug", "-sample", "2", "testdata/logs.jsonl"},
+		},
+		{
+			name: "expression and map",
+			args: []string{"-e", `grep '"error"'`, "-map", "{{.level}}: {{.msg}}", "testdata/logs.jsonl"},
+		},
+		{
+			name: "invalid expression",
+			args: []string{"-e", "grep error | sample ten"},
+		},
+		{
+			name:  "jq error",
+			args:  []string{"-jq", ".msg"},
+			stdin: "not json\n",
+		},
+		{
+			name: "missing file",
+			args: []string{"testdata/missing.txt"},
+		},
+		{
+			name: "run",
+			args: []string{"run", "-grep", "line", "--", "sh", "-c", "echo line 1; echo skipped; echo line 2 >&2"},
+		},
+		{
+			name: "run stdout only",
+			args: []string{"run", "-stream", "stdout", "-e", "replace line LINE", "--", "sh", "-c", "echo line 1; sleep 0.01; echo line 2 >&2"},
+		},
+		{
+			name: "run exit code",
+			args: []string{"run", "--", "sh", "-c", "echo failing; exit 3"},
+		},
+		{
+			name: "run terminated by signal",
+			args: []string{"run", "--", "sh", "-c", "echo terminating; kill -TERM $$"},
+		},
+		{
+			name:  "run stdin",
+			args:  []string{"run", "-jq", ".a", "--", "cat"},
+			stdin: `{"a":1}` + "\n" + `{"a":2}` + "\n",
+		},
+		{
+			name: "run command not found",
+			args: []string{"run", "--", "streamline-command-that-does-not-exist"},
+		},
+		{
+			name: "run without command",
+			args: []string{"run"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			cmd := exec.Command(binary, tc.args...)
+			cmd.Stdin = strings.NewReader(tc.stdin)
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			exitCode := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			} else {
+				require.NoError(t, err)
+			}
+
+			command := []string{"streamline"}
+			for _, arg := range tc.args {
+				command = append(command, dsl.Quote(arg))
+			}
+			got := fmt.Sprintf("$ %s\nexit code: %d\n--- stdout\n%s--- stderr\n%s",
+				strings.Join(command, " "), exitCode, stdout.String(), stderr.String())
+
+			golden := filepath.Join("testdata", "golden", strings.ReplaceAll(tc.name, " ", "_")+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(got), 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err, "golden file not found - run with -update to create it")
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
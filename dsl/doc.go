@@ -0,0 +1,8 @@
+// Package dsl provides a parser for a compact, pipe-separated syntax for building
+// pipeline.Pipeline instances, such as:
+//
+//	grep "ERROR" | sample 10 | jq '.msg' | head 100
+//
+// This is useful for accepting pipelines from users, for example through command-line
+// flags. Stages are built from a Registry, which can be extended with custom stages.
+package dsl
@@ -0,0 +1,34 @@
+package dsl_test
+
+import (
+	"fmt"
+	"strings"
+
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/dsl"
+)
+
+func ExampleCompile() {
+	data := strings.NewReader(`{"level":"info","msg":"starting"}
+{"level":"error","msg":"connection refused"}
+{"level":"error","msg":"timeout"}`)
+
+	p, err := dsl.Compile(`grep '"error"' | jq '.msg' | head 1`)
+	if err != nil {
+		fmt.Println("invalid expression:", err.Error())
+	}
+
+	lines, _ := streamline.New(data).WithPipeline(p).Lines()
+	fmt.Println(lines)
+	// Output: ["connection refused"]
+}
+
+func ExampleError() {
+	_, err := dsl.Compile(`grep ERROR | sample ten`)
+	fmt.Println(err.(*dsl.Error).Pointer())
+	fmt.Println(err.Error())
+	// Output:
+	// grep ERROR | sample ten
+	//                     ^
+	// column 21: sample: expected a non-negative integer, got "ten"
+}
@@ -0,0 +1,284 @@
+package dsl
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Expression is a parsed pipeline expression, consisting of stages separated by '|'.
+type Expression struct {
+	Stages []Stage
+
+	// input is the original expression, if this Expression was created by Parse.
+	input string
+}
+
+// Stage is a single stage in an Expression, such as `sample 10`.
+type Stage struct {
+	// Name is the name of the stage, which is used to look up the stage in a Registry.
+	Name string
+	// Args are the arguments provided to the stage.
+	Args []Arg
+	// Column is the 1-indexed column at which the stage's name starts.
+	Column int
+}
+
+// Arg is an argument to a Stage.
+type Arg struct {
+	// Value is the argument with any quoting and escapes removed.
+	Value string
+	// Column is the 1-indexed column at which the argument starts.
+	Column int
+}
+
+// String renders the Expression in a canonical form that can be parsed again with Parse
+// to produce an equivalent Expression.
+func (e Expression) String() string {
+	stages := make([]string, len(e.Stages))
+	for i, s := range e.Stages {
+		stages[i] = s.String()
+	}
+	return strings.Join(stages, " | ")
+}
+
+// String renders the Stage in a canonical form, quoting arguments where necessary.
+func (s Stage) String() string {
+	parts := make([]string, 0, len(s.Args)+1)
+	parts = append(parts, s.Name)
+	for _, a := range s.Args {
+		parts = append(parts, Quote(a.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Quote quotes value such that it is parsed as a single argument. Values that do not
+// need quoting are returned as-is, and single quotes are preferred over double quotes.
+func Quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r|'\"") {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n\r\t") {
+		return "'" + value + "'"
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// Error is returned when an expression cannot be parsed or built. It indicates the
+// position in the expression that caused the error.
+type Error struct {
+	// Input is the expression that was being processed.
+	Input string
+	// Column is the 1-indexed column of the error in Input.
+	Column int
+	// Message describes the error.
+	Message string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Pointer renders the input with a caret under the column of the error, for display to
+// users.
+func (e *Error) Pointer() string {
+	if e.Column < 1 {
+		return e.Input
+	}
+	return e.Input + "\n" + strings.Repeat(" ", e.Column-1) + "^"
+}
+
+// Parse parses a pipeline expression. Stages are separated by '|', and each stage is
+// a name followed by whitespace-separated arguments. Arguments can be quoted:
+//
+//   - single-quoted arguments are used literally
+//   - double-quoted arguments support the escapes \", \\, \n, \r, and \t - other
+//     backslashes are retained, so that e.g. regular expressions can be written as-is
+//
+// Parse only checks the syntax of the expression - use (Registry).Build to build the
+// Pipeline.
+func Parse(input string) (*Expression, error) {
+	p := &parser{input: input}
+	expr := &Expression{input: input}
+	for {
+		stage, err := p.parseStage()
+		if err != nil {
+			return nil, err
+		}
+		expr.Stages = append(expr.Stages, *stage)
+
+		p.skipSpace()
+		if p.done() {
+			return expr, nil
+		}
+		// parseStage only stops at the end of the input or a '|'.
+		p.pos++
+	}
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.input) }
+
+func (p *parser) peek() byte { return p.input[p.pos] }
+
+// column returns the 1-indexed column of the byte offset pos, counted in runes.
+func (p *parser) column(pos int) int {
+	return utf8.RuneCountInString(p.input[:pos]) + 1
+}
+
+func (p *parser) errorf(pos int, format string, args ...any) *Error {
+	return &Error{
+		Input:   p.input,
+		Column:  p.column(pos),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && isSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) parseStage() (*Stage, error) {
+	p.skipSpace()
+	if p.done() || p.peek() == '|' {
+		return nil, p.errorf(p.pos, "expected stage name")
+	}
+	if c := p.peek(); c == '\'' || c == '"' {
+		return nil, p.errorf(p.pos, "stage name must not be quoted")
+	}
+
+	stage := &Stage{Column: p.column(p.pos)}
+	name, err := p.parseWord()
+	if err != nil {
+		return nil, err
+	}
+	stage.Name = name
+
+	for {
+		p.skipSpace()
+		if p.done() || p.peek() == '|' {
+			return stage, nil
+		}
+		arg := Arg{Column: p.column(p.pos)}
+		switch p.peek() {
+		case '\'':
+			arg.Value, err = p.parseSingleQuoted()
+		case '"':
+			arg.Value, err = p.parseDoubleQuoted()
+		default:
+			arg.Value, err = p.parseWord()
+		}
+		if err != nil {
+			return nil, err
+		}
+		stage.Args = append(stage.Args, arg)
+	}
+}
+
+func (p *parser) parseWord() (string, error) {
+	start := p.pos
+	for !p.done() {
+		c := p.peek()
+		if isSpace(c) || c == '|' {
+			break
+		}
+		if c == '\'' || c == '"' {
+			return "", p.errorf(p.pos, "unexpected quote in unquoted argument %q", p.input[start:p.pos])
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos], nil
+}
+
+func (p *parser) parseSingleQuoted() (string, error) {
+	start := p.pos
+	end := strings.IndexByte(p.input[start+1:], '\'')
+	if end < 0 {
+		return "", p.errorf(start, "unterminated single-quoted string")
+	}
+	p.pos = start + 1 + end + 1
+	if err := p.expectArgEnd(); err != nil {
+		return "", err
+	}
+	return p.input[start+1 : start+1+end], nil
+}
+
+func (p *parser) parseDoubleQuoted() (string, error) {
+	start := p.pos
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for !p.done() {
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			if err := p.expectArgEnd(); err != nil {
+				return "", err
+			}
+			return sb.String(), nil
+		case '\\':
+			if p.pos+1 >= len(p.input) {
+				break
+			}
+			switch next := p.input[p.pos+1]; next {
+			case '"', '\\':
+				sb.WriteByte(next)
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+			p.pos += 2
+			continue
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+	return "", p.errorf(start, "unterminated double-quoted string")
+}
+
+// expectArgEnd checks that a quoted argument is followed by whitespace, a '|', or the
+// end of the input.
+func (p *parser) expectArgEnd() error {
+	if p.done() || isSpace(p.peek()) || p.peek() == '|' {
+		return nil
+	}
+	return p.errorf(p.pos, "expected space or '|' after quoted argument")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
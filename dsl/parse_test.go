@@ -0,0 +1,219 @@
+package dsl
+
+import (
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		input      string
+		want       autogold.Value
+		wantString autogold.Value
+	}{
+		{
+			name:  "single stage",
+			input: "sample 10",
+			want: autogold.Expect(&Expression{
+				Stages: []Stage{{
+					Name:   "sample",
+					Args:   []Arg{{Value: "10", Column: 8}},
+					Column: 1,
+				}},
+				input: "sample 10",
+			}),
+			wantString: autogold.Expect("sample 10"),
+		},
+		{
+			name:  "multiple stages with quoting",
+			input: `grep "ERROR" | sample 10 | jq '.msg' | head 100`,
+			want: autogold.Expect(&Expression{
+				Stages: []Stage{
+					{
+						Name:   "grep",
+						Args:   []Arg{{Value: "ERROR", Column: 6}},
+						Column: 1,
+					},
+					{
+						Name:   "sample",
+						Args:   []Arg{{Value: "10", Column: 23}},
+						Column: 16,
+					},
+					{
+						Name:   "jq",
+						Args:   []Arg{{Value: ".msg", Column: 31}},
+						Column: 28,
+					},
+					{
+						Name:   "head",
+						Args:   []Arg{{Value: "100", Column: 45}},
+						Column: 40,
+					},
+				},
+				input: `grep "ERROR" | sample 10 | jq '.msg' | head 100`,
+			}),
+			wantString: autogold.Expect("grep ERROR | sample 10 | jq .msg | head 100"),
+		},
+		{
+			name:  "escapes and special characters",
+			input: `replace "\d+ \"items\"" 'a | b' | jq ".a\n.b" | redact ''`,
+			want: autogold.Expect(&Expression{
+				Stages: []Stage{
+					{
+						Name: "replace",
+						Args: []Arg{
+							{
+								Value:  `\d+ "items"`,
+								Column: 9,
+							},
+							{
+								Value:  "a | b",
+								Column: 25,
+							},
+						},
+						Column: 1,
+					},
+					{
+						Name: "jq",
+						Args: []Arg{{
+							Value:  ".a\n.b",
+							Column: 38,
+						}},
+						Column: 35,
+					},
+					{
+						Name:   "redact",
+						Args:   []Arg{{Column: 56}},
+						Column: 49,
+					},
+				},
+				input: `replace "\d+ \"items\"" 'a | b' | jq ".a\n.b" | redact ''`,
+			}),
+			wantString: autogold.Expect(`replace '\d+ "items"' 'a | b' | jq ".a\n.b" | redact ''`),
+		},
+		{
+			name:  "no spaces around pipes",
+			input: "normalize|head 1",
+			want: autogold.Expect(&Expression{
+				Stages: []Stage{
+					{
+						Name:   "normalize",
+						Column: 1,
+					},
+					{
+						Name:   "head",
+						Args:   []Arg{{Value: "1", Column: 16}},
+						Column: 11,
+					},
+				},
+				input: "normalize|head 1",
+			}),
+			wantString: autogold.Expect("normalize | head 1"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			expr, err := Parse(tc.input)
+			require.NoError(t, err)
+			tc.want.Equal(t, expr)
+
+			// Printed expressions should round-trip.
+			printed := expr.String()
+			tc.wantString.Equal(t, printed)
+			reparsed, err := Parse(printed)
+			require.NoError(t, err)
+			assert.Equal(t, printed, reparsed.String())
+			for i := range expr.Stages {
+				assert.Equal(t, expr.Stages[i].Name, reparsed.Stages[i].Name)
+				for j := range expr.Stages[i].Args {
+					assert.Equal(t, expr.Stages[i].Args[j].Value, reparsed.Stages[i].Args[j].Value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		input       string
+		wantErr     autogold.Value
+		wantPointer autogold.Value
+	}{
+		{
+			name:        "empty",
+			input:       "",
+			wantErr:     autogold.Expect("column 1: expected stage name"),
+			wantPointer: autogold.Expect("\n^"),
+		},
+		{
+			name:        "trailing pipe",
+			input:       "sample 10 |",
+			wantErr:     autogold.Expect("column 12: expected stage name"),
+			wantPointer: autogold.Expect("sample 10 |\n           ^"),
+		},
+		{
+			name:        "unterminated string",
+			input:       `grep "foo | head 1`,
+			wantErr:     autogold.Expect("column 6: unterminated double-quoted string"),
+			wantPointer: autogold.Expect("grep \"foo | head 1\n     ^"),
+		},
+		{
+			name:        "quote inside word",
+			input:       `grep foo"bar"`,
+			wantErr:     autogold.Expect(`column 9: unexpected quote in unquoted argument "foo"`),
+			wantPointer: autogold.Expect("grep foo\"bar\"\n        ^"),
+		},
+		{
+			name:        "quoted stage name",
+			input:       `'grep' foo`,
+			wantErr:     autogold.Expect("column 1: stage name must not be quoted"),
+			wantPointer: autogold.Expect("'grep' foo\n^"),
+		},
+		{
+			name:        "unicode columns",
+			input:       `grep "héllo"x`,
+			wantErr:     autogold.Expect("column 13: expected space or '|' after quoted argument"),
+			wantPointer: autogold.Expect("grep \"héllo\"x\n            ^"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			_, err := Parse(tc.input)
+			require.Error(t, err)
+			tc.wantErr.Equal(t, err.Error())
+
+			var dslErr *Error
+			require.ErrorAs(t, err, &dslErr)
+			tc.wantPointer.Equal(t, dslErr.Pointer())
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for value, want := range map[string]string{
+		"foo":      "foo",
+		"":         "''",
+		"foo bar":  "'foo bar'",
+		`.["a"]`:   `'.["a"]'`,
+		"it's":     `"it's"`,
+		"a\tb":     `"a\tb"`,
+		`\d+`:      `\d+`,
+		`it's \d+`: `"it's \\d+"`,
+	} {
+		got := Quote(value)
+		assert.Equal(t, want, got)
+
+		expr, err := Parse("stage " + got)
+		require.NoError(t, err)
+		assert.Equal(t, value, expr.Stages[0].Args[0].Value)
+	}
+}
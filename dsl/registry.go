@@ -0,0 +1,317 @@
+package dsl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.bobheadxi.dev/streamline/jq"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// StageFunc builds a Pipeline from the arguments provided to a stage. To indicate that a
+// specific argument is invalid, implementations can return an *ArgError.
+type StageFunc func(args []string) (pipeline.Pipeline, error)
+
+// ArgError can be returned by a StageFunc to indicate which argument caused an error,
+// which allows the error to be reported at the argument's position.
+type ArgError struct {
+	// Index is the index of the invalid argument.
+	Index int
+	// Err is the reason the argument is invalid.
+	Err error
+}
+
+func (e *ArgError) Error() string { return e.Err.Error() }
+
+func (e *ArgError) Unwrap() error { return e.Err }
+
+// StageSpec describes a stage that can be used in an expression.
+type StageSpec struct {
+	// Usage describes the stage's arguments, e.g. "sample N".
+	Usage string
+	// MinArgs and MaxArgs are the number of arguments the stage accepts. If MaxArgs is
+	// negative, any number of arguments is accepted.
+	MinArgs, MaxArgs int
+	// Build creates the stage's Pipeline.
+	Build StageFunc
+}
+
+// Registry is a set of stages, keyed by name, that can be used to build expressions.
+type Registry map[string]StageSpec
+
+// DefaultRegistry returns a new registry with the built-in stages:
+//
+//   - grep [-v] [-i] [-F] PATTERN: retain lines matching the regular expression PATTERN,
+//     or the literal PATTERN with -F. -v inverts the match, and -i ignores case.
+//   - replace PATTERN REPLACEMENT: replace matches of the regular expression PATTERN,
+//     which supports regexp.Regexp expansion syntax like ${1} in REPLACEMENT.
+//   - sample N: retain every Nth line - see pipeline.Sample.
+//   - head N: retain only the first N lines.
+//   - skip N: omit the first N lines.
+//   - jq QUERY: map each line to the output of a jq query - see jq.Pipeline.
+//   - template TEMPLATE: render JSON lines with a template - see pipeline.Template.
+//   - normalize: normalize structured logs - see pipeline.NormalizeLogs.
+//   - redact [SECRET...]: redact sensitive data and the given literal secrets - see
+//     pipeline.Redact.
+//   - timestamp [wall|relative|delta]: annotate lines with timestamps - see
+//     pipeline.Timestamp.
+func DefaultRegistry() Registry {
+	return Registry{
+		"grep": {
+			Usage:   "grep [-v] [-i] [-F] PATTERN",
+			MinArgs: 1, MaxArgs: 4,
+			Build: buildGrep,
+		},
+		"replace": {
+			Usage:   "replace PATTERN REPLACEMENT",
+			MinArgs: 2, MaxArgs: 2,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				re, err := regexp.Compile(args[0])
+				if err != nil {
+					return nil, &ArgError{Index: 0, Err: err}
+				}
+				replacement := []byte(args[1])
+				return pipeline.Map(func(line []byte) []byte {
+					return re.ReplaceAll(line, replacement)
+				}), nil
+			},
+		},
+		"sample": {
+			Usage:   "sample N",
+			MinArgs: 1, MaxArgs: 1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				n, err := parseCount(args, 0)
+				if err != nil {
+					return nil, err
+				}
+				return pipeline.Sample(n), nil
+			},
+		},
+		"head": {
+			Usage:   "head N",
+			MinArgs: 1, MaxArgs: 1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				n, err := parseCount(args, 0)
+				if err != nil {
+					return nil, err
+				}
+				return pipeline.MapIdx(func(i int, line []byte) ([]byte, error) {
+					if i < n {
+						return line, nil
+					}
+					return nil, nil
+				}), nil
+			},
+		},
+		"skip": {
+			Usage:   "skip N",
+			MinArgs: 1, MaxArgs: 1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				n, err := parseCount(args, 0)
+				if err != nil {
+					return nil, err
+				}
+				return pipeline.MapIdx(func(i int, line []byte) ([]byte, error) {
+					if i < n {
+						return nil, nil
+					}
+					return line, nil
+				}), nil
+			},
+		},
+		"jq": {
+			Usage:   "jq QUERY",
+			MinArgs: 1, MaxArgs: 1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				p, err := jq.BuildPipeline(context.Background(), args[0])
+				if err != nil {
+					return nil, &ArgError{Index: 0, Err: err}
+				}
+				return p, nil
+			},
+		},
+		"template": {
+			Usage:   "template TEMPLATE",
+			MinArgs: 1, MaxArgs: 1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				p, err := pipeline.BuildTemplate(args[0], pipeline.TemplateOptions{})
+				if err != nil {
+					return nil, &ArgError{Index: 0, Err: err}
+				}
+				return p, nil
+			},
+		},
+		"normalize": {
+			Usage: "normalize",
+			Build: func([]string) (pipeline.Pipeline, error) {
+				return pipeline.NormalizeLogs(nil), nil
+			},
+		},
+		"redact": {
+			Usage:   "redact [SECRET...]",
+			MaxArgs: -1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				return pipeline.Redact(pipeline.RedactOptions{Secrets: args}), nil
+			},
+		},
+		"timestamp": {
+			Usage:   "timestamp [wall|relative|delta]",
+			MaxArgs: 1,
+			Build: func(args []string) (pipeline.Pipeline, error) {
+				var opts pipeline.TimestampOptions
+				if len(args) > 0 {
+					switch args[0] {
+					case "wall":
+						opts.Format = pipeline.TimestampWallClock
+					case "relative":
+						opts.Format = pipeline.TimestampRelative
+					case "delta":
+						opts.Format = pipeline.TimestampDelta
+					default:
+						return nil, &ArgError{Index: 0, Err: fmt.Errorf("unknown format %q", args[0])}
+					}
+				}
+				return pipeline.Timestamp(opts), nil
+			},
+		},
+	}
+}
+
+// Register adds a stage to the registry, replacing any existing stage with the same name.
+func (r Registry) Register(name string, spec StageSpec) {
+	r[name] = spec
+}
+
+// Compile parses and builds the input expression with the stages in this registry.
+func (r Registry) Compile(input string) (pipeline.Pipeline, error) {
+	expr, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return r.Build(expr)
+}
+
+// Build creates a Pipeline from the parsed expression with the stages in this registry.
+func (r Registry) Build(expr *Expression) (pipeline.Pipeline, error) {
+	input := expr.input
+	if input == "" {
+		input = expr.String()
+	}
+	mp := make(pipeline.MultiPipeline, 0, len(expr.Stages))
+	for _, stage := range expr.Stages {
+		spec, ok := r[stage.Name]
+		if !ok {
+			return nil, &Error{
+				Input:   input,
+				Column:  stage.Column,
+				Message: fmt.Sprintf("unknown stage %q, expected one of: %s", stage.Name, strings.Join(r.names(), ", ")),
+			}
+		}
+		if len(stage.Args) < spec.MinArgs || (spec.MaxArgs >= 0 && len(stage.Args) > spec.MaxArgs) {
+			return nil, &Error{
+				Input:   input,
+				Column:  stage.Column,
+				Message: fmt.Sprintf("%s: unexpected number of arguments %d, usage: %s", stage.Name, len(stage.Args), spec.Usage),
+			}
+		}
+
+		args := make([]string, len(stage.Args))
+		for i, a := range stage.Args {
+			args[i] = a.Value
+		}
+		p, err := spec.Build(args)
+		if err != nil {
+			column := stage.Column
+			var argErr *ArgError
+			if errors.As(err, &argErr) && argErr.Index >= 0 && argErr.Index < len(stage.Args) {
+				column = stage.Args[argErr.Index].Column
+			}
+			return nil, &Error{
+				Input:   input,
+				Column:  column,
+				Message: fmt.Sprintf("%s: %s", stage.Name, err.Error()),
+				Err:     err,
+			}
+		}
+		mp = append(mp, p)
+	}
+	return mp, nil
+}
+
+// names returns the sorted names of stages in the registry.
+func (r Registry) names() []string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Compile parses and builds the input expression with the stages in DefaultRegistry.
+func Compile(input string) (pipeline.Pipeline, error) {
+	return DefaultRegistry().Compile(input)
+}
+
+// MustCompile is like Compile, but panics if the expression cannot be compiled.
+func MustCompile(input string) pipeline.Pipeline {
+	p, err := Compile(input)
+	if err != nil {
+		panic(fmt.Sprintf("dsl: Compile(%q): %s", input, err.Error()))
+	}
+	return p
+}
+
+func buildGrep(args []string) (pipeline.Pipeline, error) {
+	var invert, ignoreCase, fixed bool
+	for i, arg := range args[:len(args)-1] {
+		switch arg {
+		case "-v":
+			invert = true
+		case "-i":
+			ignoreCase = true
+		case "-F":
+			fixed = true
+		default:
+			return nil, &ArgError{Index: i, Err: fmt.Errorf("unknown flag %q", arg)}
+		}
+	}
+
+	pattern := args[len(args)-1]
+	if fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &ArgError{Index: len(args) - 1, Err: err}
+	}
+
+	// Fast path for case-sensitive literal matches.
+	if fixed && !ignoreCase {
+		literal := []byte(args[len(args)-1])
+		return pipeline.Filter(func(line []byte) bool {
+			return bytes.Contains(line, literal) != invert
+		}), nil
+	}
+	return pipeline.Filter(func(line []byte) bool {
+		return re.Match(line) != invert
+	}), nil
+}
+
+// parseCount parses args[i] as a non-negative integer.
+func parseCount(args []string, i int) (int, error) {
+	n, err := strconv.Atoi(args[i])
+	if err != nil || n < 0 {
+		return 0, &ArgError{Index: i, Err: fmt.Errorf("expected a non-negative integer, got %q", args[i])}
+	}
+	return n, nil
+}
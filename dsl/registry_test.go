@@ -0,0 +1,182 @@
+package dsl_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/dsl"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+func TestCompile(t *testing.T) {
+	input := `{"level":"info","msg":"starting"}
+{"level":"error","msg":"ERROR: connection refused"}
+plain ERROR line
+{"level":"error","msg":"ERROR: timeout"}
+{"level":"error","msg":"ERROR: disk full"}`
+
+	for _, tc := range []struct {
+		name string
+		expr string
+		want autogold.Value
+	}{
+		{
+			name: "grep, jq, and head",
+			expr: `grep '"error"' | jq '.msg' | head 2`,
+			want: autogold.Expect([]string{`"ERROR: connection refused"`, `"ERROR: timeout"`}),
+		},
+		{
+			name: "grep flags",
+			expr: `grep -v -i -F '"LEVEL":"ERROR"'`,
+			want: autogold.Expect([]string{`{"level":"info","msg":"starting"}`, "plain ERROR line"}),
+		},
+		{
+			name: "sample and skip",
+			expr: "skip 1 | sample 2",
+			want: autogold.Expect([]string{
+				"plain ERROR line",
+				`{"level":"error","msg":"ERROR: disk full"}`,
+			}),
+		},
+		{
+			name: "replace and template",
+			expr: `grep ^{ | template '{{.level}}: {{.msg}}' | replace '^(\w+): ERROR: ' '$1! '`,
+			want: autogold.Expect([]string{
+				"info: starting", "error! connection refused",
+				"error! timeout",
+				"error! disk full",
+			}),
+		},
+		{
+			name: "normalize and redact",
+			expr: "normalize | redact timeout | jq .message | head 4 | skip 3",
+			want: autogold.Expect([]string{`"ERROR: [REDACTED]"`}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			p, err := dsl.Compile(tc.expr)
+			require.NoError(t, err)
+
+			lines, err := streamline.New(strings.NewReader(input)).
+				WithPipeline(p).
+				Lines()
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		expr        string
+		wantErr     autogold.Value
+		wantPointer autogold.Value
+	}{
+		{
+			name:        "unknown stage",
+			expr:        "sample 2 | grpe foo",
+			wantErr:     autogold.Expect("column 12: unknown stage \"grpe\", expected one of: grep, head, jq, normalize, redact, replace, sample, skip, template, timestamp"),
+			wantPointer: autogold.Expect("sample 2 | grpe foo\n           ^"),
+		},
+		{
+			name:        "wrong number of arguments",
+			expr:        "sample 2 3",
+			wantErr:     autogold.Expect("column 1: sample: unexpected number of arguments 2, usage: sample N"),
+			wantPointer: autogold.Expect("sample 2 3\n^"),
+		},
+		{
+			name:        "invalid count",
+			expr:        "head -1",
+			wantErr:     autogold.Expect(`column 6: head: expected a non-negative integer, got "-1"`),
+			wantPointer: autogold.Expect("head -1\n     ^"),
+		},
+		{
+			name:        "invalid jq query",
+			expr:        "grep foo | jq '.foo{'",
+			wantErr:     autogold.Expect(`column 15: jq: jq.Parse: unexpected token "{"`),
+			wantPointer: autogold.Expect("grep foo | jq '.foo{'\n              ^"),
+		},
+		{
+			name:        "invalid grep flag",
+			expr:        "grep -x foo",
+			wantErr:     autogold.Expect(`column 6: grep: unknown flag "-x"`),
+			wantPointer: autogold.Expect("grep -x foo\n     ^"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			_, err := dsl.Compile(tc.expr)
+			require.Error(t, err)
+			tc.wantErr.Equal(t, err.Error())
+
+			var dslErr *dsl.Error
+			require.ErrorAs(t, err, &dslErr)
+			tc.wantPointer.Equal(t, dslErr.Pointer())
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("custom stage", func(t *testing.T) {
+		t.Parallel()
+
+		registry := dsl.DefaultRegistry()
+		registry.Register("upper", dsl.StageSpec{
+			Usage: "upper",
+			Build: func([]string) (pipeline.Pipeline, error) {
+				return pipeline.Map(bytes.ToUpper), nil
+			},
+		})
+
+		p, err := registry.Compile("upper | grep FOO")
+		require.NoError(t, err)
+		lines, err := streamline.New(strings.NewReader("foo\nbar")).WithPipeline(p).Lines()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"FOO"}, lines)
+	})
+
+	t.Run("custom stage errors", func(t *testing.T) {
+		t.Parallel()
+
+		wantErr := errors.New("oh no")
+		registry := dsl.Registry{
+			"fail": {
+				MaxArgs: -1,
+				Build: func(args []string) (pipeline.Pipeline, error) {
+					return nil, &dsl.ArgError{Index: 1, Err: wantErr}
+				},
+			},
+		}
+
+		_, err := registry.Compile("fail a b c")
+		require.Error(t, err)
+		assert.ErrorIs(t, err, wantErr)
+		autogold.Expect("column 8: fail: oh no").Equal(t, err.Error())
+	})
+
+	t.Run("build expression", func(t *testing.T) {
+		t.Parallel()
+
+		expr := &dsl.Expression{Stages: []dsl.Stage{{
+			Name: "sample",
+			Args: []dsl.Arg{{Value: "2"}},
+		}}}
+		p, err := dsl.DefaultRegistry().Build(expr)
+		require.NoError(t, err)
+		lines, err := streamline.New(strings.NewReader("foo\nbar")).WithPipeline(p).Lines()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bar"}, lines)
+	})
+}
@@ -3,12 +3,16 @@ module go.bobheadxi.dev/streamline
 go 1.19
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/djherbis/buffer v1.2.0
 	github.com/djherbis/nio/v3 v3.0.1
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/hexops/autogold/v2 v2.2.1
 	github.com/itchyny/gojq v0.12.14
 	github.com/stretchr/testify v1.8.4
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	go.bobheadxi.dev/gobenchdata v1.3.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -27,10 +31,11 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/mod v0.14.0 // indirect
 	golang.org/x/net v0.20.0 // indirect
 	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/tools v0.17.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	mvdan.cc/gofumpt v0.5.0 // indirect
 )
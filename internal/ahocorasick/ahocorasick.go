@@ -0,0 +1,123 @@
+// Package ahocorasick implements the Aho-Corasick string matching algorithm, which finds
+// occurrences of many literal patterns in a single pass over the input.
+package ahocorasick
+
+// Matcher finds occurrences of a set of patterns. It is safe for concurrent use.
+//
+// Internally, the automaton is compiled into a deterministic transition table over the
+// set of bytes that occur in the patterns, so matching costs a single table lookup per
+// byte of input regardless of how many patterns there are.
+type Matcher struct {
+	// classes maps each byte to its index in the transition table. Bytes that do not
+	// occur in any pattern all map to class 0.
+	classes [256]int32
+	// stride is the number of byte classes.
+	stride int32
+	// delta is the transition table, indexed by state*stride+class.
+	delta []int32
+	// outputs holds the length of the longest pattern that ends at each state, including
+	// patterns reachable through failure links, or 0 if none.
+	outputs []int
+}
+
+// Match is an occurrence of a pattern in the input.
+type Match struct {
+	// Start and End are the offsets of the match in the input, such that the match is
+	// input[Start:End].
+	Start, End int
+}
+
+// New builds a Matcher for the given patterns. Empty patterns are ignored.
+func New(patterns []string) *Matcher {
+	m := &Matcher{stride: 1}
+	for _, p := range patterns {
+		for i := 0; i < len(p); i++ {
+			if m.classes[p[i]] == 0 {
+				m.classes[p[i]] = m.stride
+				m.stride++
+			}
+		}
+	}
+
+	// Build the trie, where -1 indicates a missing transition.
+	newState := func() int32 {
+		for i := int32(0); i < m.stride; i++ {
+			m.delta = append(m.delta, -1)
+		}
+		m.outputs = append(m.outputs, 0)
+		return int32(len(m.outputs) - 1)
+	}
+	newState() // root
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		var cur int32
+		for i := 0; i < len(p); i++ {
+			idx := cur*m.stride + m.classes[p[i]]
+			if m.delta[idx] < 0 {
+				next := newState()
+				m.delta[idx] = next
+			}
+			cur = m.delta[idx]
+		}
+		if len(p) > m.outputs[cur] {
+			m.outputs[cur] = len(p)
+		}
+	}
+
+	// Compute failure links breadth-first, so that links always point to states that
+	// have already been processed, and fill in missing transitions by following them.
+	fail := make([]int32, len(m.outputs))
+	queue := make([]int32, 0, len(m.outputs))
+	for c := int32(0); c < m.stride; c++ {
+		if next := m.delta[c]; next > 0 {
+			queue = append(queue, next)
+		} else {
+			m.delta[c] = 0
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		// Inherit the output of the failure state, since patterns ending there also end
+		// here, but keep our own output if it is longer.
+		if out := m.outputs[fail[cur]]; out > m.outputs[cur] {
+			m.outputs[cur] = out
+		}
+
+		for c := int32(0); c < m.stride; c++ {
+			idx := cur*m.stride + c
+			if next := m.delta[idx]; next >= 0 {
+				fail[next] = m.delta[fail[cur]*m.stride+c]
+				queue = append(queue, next)
+			} else {
+				m.delta[idx] = m.delta[fail[cur]*m.stride+c]
+			}
+		}
+	}
+
+	return m
+}
+
+// Empty returns true if the Matcher has no patterns.
+func (m *Matcher) Empty() bool { return len(m.outputs) == 1 }
+
+// FindAll returns all occurrences of the patterns in input, including overlapping
+// occurrences, ordered by their end offset. Where several patterns end at the same
+// offset, only the longest is reported.
+func (m *Matcher) FindAll(input []byte) []Match {
+	if m.Empty() {
+		return nil
+	}
+	var matches []Match
+	var state int32
+	for i, b := range input {
+		state = m.delta[state*m.stride+m.classes[b]]
+		if out := m.outputs[state]; out > 0 {
+			matches = append(matches, Match{Start: i + 1 - out, End: i + 1})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,64 @@
+package ahocorasick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		input    string
+		want     []Match
+	}{
+		{
+			name:     "no patterns",
+			patterns: nil,
+			input:    "hello world",
+			want:     nil,
+		},
+		{
+			name:     "empty patterns ignored",
+			patterns: []string{""},
+			input:    "hello world",
+			want:     nil,
+		},
+		{
+			name:     "single pattern",
+			patterns: []string{"world"},
+			input:    "hello world, goodbye world",
+			want:     []Match{{Start: 6, End: 11}, {Start: 21, End: 26}},
+		},
+		{
+			name:     "overlapping patterns",
+			patterns: []string{"he", "she", "his", "hers"},
+			input:    "ushers",
+			want:     []Match{{Start: 1, End: 4}, {Start: 2, End: 6}},
+		},
+		{
+			name:     "pattern found through dictionary link",
+			patterns: []string{"abcd", "bc"},
+			input:    "abce",
+			want:     []Match{{Start: 1, End: 3}},
+		},
+		{
+			name:     "repeated characters",
+			patterns: []string{"aa"},
+			input:    "aaaa",
+			want:     []Match{{Start: 0, End: 2}, {Start: 1, End: 3}, {Start: 2, End: 4}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			got := New(tc.patterns).FindAll([]byte(tc.input))
+			assert.Equal(t, tc.want, got)
+			for _, m := range got {
+				assert.Contains(t, tc.patterns, tc.input[m.Start:m.End])
+			}
+		})
+	}
+}
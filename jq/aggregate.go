@@ -0,0 +1,184 @@
+package jq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// Aggregation describes how to aggregate JSON lines into a single state, similar to
+// jq's 'reduce' - see Aggregate.
+//
+// If a query produces multiple results, the last result is used as the state. If it
+// produces no results, the state becomes null.
+type Aggregation struct {
+	// Init is a query that produces the initial state, run against null. If empty, the
+	// initial state is null.
+	Init string
+	// Update is a query that produces the next state, run against the current state with
+	// each decoded line available as $line. For example, '.[$line.level] += 1' counts
+	// lines by level.
+	Update string
+	// Emit is an optional query that is run against the state to produce output, for
+	// example to compute a percentile from collected values. If empty, the state is
+	// emitted as-is.
+	Emit string
+	// EmitEvery configures the output to also be emitted every EmitEvery lines. If zero,
+	// output is only emitted at the end of the stream. Output is not emitted again at the
+	// end of the stream if no lines were aggregated since it was last emitted.
+	EmitEvery int
+}
+
+// Aggregate builds a pipeline that aggregates JSON lines into a single state without
+// retaining each line, and emits the output of the aggregation at the end of the stream -
+// see Aggregation. Input lines are otherwise omitted. For example, to count lines by
+// level:
+//
+//	jq.Aggregate(jq.Aggregation{Init: "{}", Update: ".[$line.level] += 1"})
+//
+// If the aggregation fails to build, Aggregate will return a pipeline that returns an
+// error immediately on read - to handle build errors, use BuildAggregate instead.
+//
+// Options that configure the output, such as WithRawOutput, apply to the emitted output.
+// Empty lines are omitted, and lines that are not valid JSON cause the pipeline to error
+// unless configured otherwise with WithNonJSON.
+func Aggregate(agg Aggregation, opts ...Option) pipeline.Pipeline {
+	return AggregateContext(context.Background(), agg, opts...)
+}
+
+// AggregateContext is the same as Aggregate, but runs the generated JQ code in the given
+// context.
+func AggregateContext(ctx context.Context, agg Aggregation, opts ...Option) pipeline.Pipeline {
+	p, err := BuildAggregate(ctx, agg, opts...)
+	if err != nil {
+		return pipeline.MapErr(func(line []byte) ([]byte, error) { return nil, err })
+	}
+	return p
+}
+
+// BuildAggregate safely builds an Aggregate pipeline, returning an error if the
+// aggregation fails to build or the initial state cannot be computed.
+func BuildAggregate(ctx context.Context, agg Aggregation, opts ...Option) (pipeline.Pipeline, error) {
+	o := buildOptions(opts)
+	if agg.Init == "" {
+		agg.Init = "null"
+	}
+	if agg.Emit == "" {
+		agg.Emit = "."
+	}
+
+	initCode, err := compile(agg.Init, o)
+	if err != nil {
+		return nil, fmt.Errorf("init: %w", err)
+	}
+	// The update query has access to the line as $line, so it is built separately.
+	updateCode, err := buildJQ(agg.Update, o, "$line")
+	if err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+	emitCode, err := compile(agg.Emit, o)
+	if err != nil {
+		return nil, fmt.Errorf("emit: %w", err)
+	}
+	if err := emitCode.pipelineError(); err != nil {
+		return nil, err
+	}
+
+	state, err := lastJQ(ctx, initCode, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("init: %w", err)
+	}
+	return &aggregatePipeline{
+		ctx:       ctx,
+		update:    updateCode,
+		emit:      emitCode,
+		emitEvery: agg.EmitEvery,
+		state:     state,
+		result:    newResultEncoder(o, &bytes.Buffer{}),
+	}, nil
+}
+
+// lastJQ returns the last result of the query, or nil if there are no results.
+func lastJQ(ctx context.Context, jqCode *Program, input interface{}, extraValues []interface{}) (interface{}, error) {
+	var last interface{}
+	err := eachJQ(ctx, jqCode, input, extraValues, func(v interface{}) error {
+		last = v
+		return nil
+	})
+	return last, err
+}
+
+type aggregatePipeline struct {
+	ctx       context.Context
+	update    *Program
+	emit      *Program
+	emitEvery int
+
+	state interface{}
+	lines int
+	// emitted indicates that the current state has already been emitted.
+	emitted bool
+
+	result *resultEncoder
+}
+
+var _ pipeline.Flusher = (*aggregatePipeline)(nil)
+
+func (p *aggregatePipeline) ProcessLine(line []byte) ([]byte, error) {
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	input, err := decodeLine(p.update.opts.inputFormat, line)
+	if err != nil {
+		switch p.update.opts.nonJSON {
+		case pipeline.NonJSONPassthrough:
+			return line, nil
+		case pipeline.NonJSONSkip:
+			return nil, nil
+		case pipeline.NonJSONWrap:
+			input = pipeline.WrapNonJSON(line)
+		default:
+			// Embed the consumed content for ease of debugging
+			return nil, fmt.Errorf("%w: %s", err, string(line))
+		}
+	}
+
+	p.state, err = lastJQ(p.ctx, p.update, p.state, []interface{}{input})
+	if err != nil {
+		// Embed the consumed content for ease of debugging
+		return nil, fmt.Errorf("%w: %s", err, string(line))
+	}
+
+	p.lines++
+	p.emitted = false
+	if p.emitEvery > 0 && p.lines%p.emitEvery == 0 {
+		return p.emitState()
+	}
+	return nil, nil
+}
+
+// Flush emits the output of the aggregation at the end of the stream, unless the state
+// has not changed since it was last emitted.
+func (p *aggregatePipeline) Flush() ([]byte, error) {
+	if p.emitted {
+		return nil, nil
+	}
+	return p.emitState()
+}
+
+// emitState runs the emit query against the current state, returning nil if there is no
+// output.
+func (p *aggregatePipeline) emitState() ([]byte, error) {
+	p.result.reset()
+	p.emitted = true
+	if err := runJQ(p.ctx, p.emit, p.state, p.result); err != nil {
+		return nil, err
+	}
+	if !p.result.written {
+		return nil, nil
+	}
+	return p.result.output.Bytes(), nil
+}
@@ -0,0 +1,127 @@
+package jq
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+func TestAggregate(t *testing.T) {
+	input := `{"level":"info","latency":10}
+{"level":"error","latency":30}
+
+{"level":"info","latency":20}
+{"level":"info","latency":40}`
+
+	for _, tc := range []struct {
+		name    string
+		agg     Aggregation
+		opts    []Option
+		want    autogold.Value
+		wantErr autogold.Value
+	}{
+		{
+			name: "count by level",
+			agg:  Aggregation{Init: "{}", Update: ".[$line.level] += 1"},
+			want: autogold.Expect([]string{`{"error":1,"info":3}`}),
+		},
+		{
+			name: "null init",
+			agg:  Aggregation{Update: ". + $line.latency"},
+			want: autogold.Expect([]string{"100"}),
+		},
+		{
+			name: "emit query",
+			agg: Aggregation{
+				Init:   "[]",
+				Update: ". + [$line.latency]",
+				Emit:   "sort | .[length * 0.75 | floor]",
+			},
+			want: autogold.Expect([]string{"40"}),
+		},
+		{
+			name: "emit every",
+			agg: Aggregation{
+				Init:      "0",
+				Update:    ". + 1",
+				EmitEvery: 3,
+			},
+			want: autogold.Expect([]string{"3", "4"}),
+		},
+		{
+			name: "emit every with exact multiple of lines",
+			agg: Aggregation{
+				Init:      "0",
+				Update:    ". + 1",
+				EmitEvery: 2,
+			},
+			want: autogold.Expect([]string{"2", "4"}),
+		},
+		{
+			name: "output options",
+			agg: Aggregation{
+				Init:   "{}",
+				Update: ".[$line.level] += 1",
+				Emit:   "to_entries[] | \"\\(.key)=\\(.value)\"",
+			},
+			opts: []Option{WithRawOutput()},
+			want: autogold.Expect([]string{"error=1", "info=3"}),
+		},
+		{
+			name:    "update error",
+			agg:     Aggregation{Init: "{}", Update: ". + $line.level"},
+			wantErr: autogold.Expect(`jq: cannot add: object ({}) and string ("info"): {"level":"info","latency":10}`),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			p, err := BuildAggregate(context.Background(), tc.agg, tc.opts...)
+			require.NoError(t, err)
+
+			lines, err := streamline.New(strings.NewReader(input)).WithPipeline(p).Lines()
+			if tc.wantErr != nil {
+				require.Error(t, err)
+				tc.wantErr.Equal(t, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+
+	t.Run("build errors", func(t *testing.T) {
+		t.Parallel()
+
+		for _, agg := range []Aggregation{
+			{Init: "{", Update: "."},
+			{Update: "$foo"},
+			{Update: ".", Emit: "asdf{"},
+		} {
+			_, err := BuildAggregate(context.Background(), agg)
+			require.Error(t, err)
+		}
+
+		_, err := BuildAggregate(context.Background(), Aggregation{Update: "$foo"})
+		autogold.Expect("update: jq.Compile: variable not defined: $foo").Equal(t, err.Error())
+	})
+
+	t.Run("non-JSON", func(t *testing.T) {
+		t.Parallel()
+
+		lines, err := streamline.New(strings.NewReader("starting\n" + input)).
+			WithPipeline(Aggregate(
+				Aggregation{Init: "0", Update: ". + 1"},
+				WithNonJSON(pipeline.NonJSONSkip),
+			)).
+			Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"4"}).Equal(t, lines)
+	})
+}
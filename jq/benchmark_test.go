@@ -0,0 +1,99 @@
+package jq
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// BenchmarkQuery compares compiling the query on each call to Query against reusing a
+// compiled Program, directly or through a Cache.
+func BenchmarkQuery(b *testing.B) {
+	const query = `select(.level == "error" and .status >= 500) | {msg, user: .user.name}`
+	data := []byte(`{"level":"error","status":503,"msg":"unavailable","user":{"name":"robert"}}`)
+
+	b.Run("Query", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Query(bytes.NewReader(data), query); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Program", func(b *testing.B) {
+		p, err := Compile(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.Query(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Cache", func(b *testing.B) {
+		cache := NewCache(16)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Query(bytes.NewReader(data), query, WithCache(cache)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Cache/Parallel", func(b *testing.B) {
+		cache := NewCache(16)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := Query(bytes.NewReader(data), query, WithCache(cache)); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkPipeline compares building a pipeline with BuildPipeline against creating one
+// from a compiled Program, for short streams where building the query dominates.
+func BenchmarkPipeline(b *testing.B) {
+	const query = `.msg`
+	lines := make([][]byte, 10)
+	for i := range lines {
+		lines[i] = []byte(fmt.Sprintf(`{"msg":"message %d"}`, i))
+	}
+
+	b.Run("BuildPipeline", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := Pipeline(query)
+			for _, line := range lines {
+				if _, err := p.ProcessLine(line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("Program", func(b *testing.B) {
+		prog, err := Compile(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			p := prog.Pipeline()
+			for _, line := range lines {
+				if _, err := p.ProcessLine(line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
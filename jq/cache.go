@@ -0,0 +1,121 @@
+package jq
+
+import (
+	"container/list"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Cache is a bounded cache of compiled Programs, keyed by query and options, that
+// evicts the least recently used Program when full. It is safe for concurrent use.
+//
+// Programs built with WithFunction are never cached, since functions cannot be compared.
+type Cache struct {
+	size int
+
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	// recent holds *Program, ordered from most to least recently used.
+	recent *list.List
+}
+
+// NewCache creates a Cache that holds up to size Programs.
+func NewCache(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		recent:  list.New(),
+	}
+}
+
+// WithCache configures Compile, Query and Pipeline to retrieve compiled Programs from the
+// given cache, compiling and adding them to the cache if they are not present.
+func WithCache(cache *Cache) Option {
+	return func(o *options) { o.cache = cache }
+}
+
+// Compile is the same as the package-level Compile with WithCache(c).
+func (c *Cache) Compile(query string, opts ...Option) (*Program, error) {
+	o := buildOptions(opts)
+	return c.compile(query, o)
+}
+
+// Len returns the number of Programs in the cache.
+func (c *Cache) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.recent.Len()
+}
+
+type cacheEntry struct {
+	key     string
+	program *Program
+}
+
+func (c *Cache) compile(query string, o *options) (*Program, error) {
+	key, ok := o.cacheKey(query)
+	if !ok {
+		return buildJQ(query, o)
+	}
+
+	c.mux.Lock()
+	if e, ok := c.entries[key]; ok {
+		c.recent.MoveToFront(e)
+		c.mux.Unlock()
+		return e.Value.(*cacheEntry).program, nil
+	}
+	c.mux.Unlock()
+
+	// Compile without holding the lock - if the same query is compiled concurrently, the
+	// last one to finish is retained.
+	p, err := buildJQ(query, o)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).program = p
+		c.recent.MoveToFront(e)
+		return p, nil
+	}
+	c.entries[key] = c.recent.PushFront(&cacheEntry{key: key, program: p})
+	for c.recent.Len() > c.size {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return p, nil
+}
+
+// cacheKey returns a key that uniquely identifies a Program built from query with these
+// options, or false if the Program cannot be cached.
+func (o *options) cacheKey(query string) (string, bool) {
+	if len(o.functions) > 0 {
+		return "", false
+	}
+	values, err := json.Marshal(o.variableValues)
+	if err != nil {
+		return "", false
+	}
+	fields, err := json.Marshal([]interface{}{
+		o.slurp, o.inputFormat, o.outputFormat, o.rawOutput, o.indent, o.separator,
+		o.variableNames, json.RawMessage(values),
+		o.environ, o.modulePaths,
+		o.nonJSON, o.skipEmpty,
+	})
+	if err != nil {
+		return "", false
+	}
+	var key strings.Builder
+	key.Grow(len(fields) + 1 + len(query))
+	key.Write(fields)
+	key.WriteByte(0)
+	key.WriteString(query)
+	return key.String(), true
+}
@@ -0,0 +1,101 @@
+package jq
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("reuses programs", func(t *testing.T) {
+		t.Parallel()
+
+		cache := NewCache(10)
+		p1, err := cache.Compile(".foo", WithRawOutput())
+		require.NoError(t, err)
+		p2, err := Compile(".foo", WithRawOutput(), WithCache(cache))
+		require.NoError(t, err)
+		assert.Same(t, p1, p2)
+		assert.Equal(t, 1, cache.Len())
+
+		res, err := Query(strings.NewReader(`{"foo":"bar"}`), ".foo", WithRawOutput(), WithCache(cache))
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(res))
+		_, err = BuildPipeline(context.Background(), ".foo", WithCache(cache), WithRawOutput())
+		require.NoError(t, err)
+		assert.Equal(t, 1, cache.Len())
+	})
+
+	t.Run("keyed by options", func(t *testing.T) {
+		t.Parallel()
+
+		cache := NewCache(10)
+		for _, opts := range [][]Option{
+			nil,
+			{WithRawOutput()},
+			{WithSlurp()},
+			{WithIndent(2)},
+			{WithSeparator("\n")},
+			{WithVariable("foo", "bar")},
+			{WithVariable("foo", "baz")},
+			{WithEnviron([]string{"FOO=bar"})},
+			{WithModulePaths(t.TempDir())},
+		} {
+			_, err := cache.Compile(".", opts...)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 9, cache.Len())
+
+		p1, err := cache.Compile(".", WithVariable("foo", "baz"))
+		require.NoError(t, err)
+		res, err := p1.Query(strings.NewReader(`null`))
+		require.NoError(t, err)
+		assert.Equal(t, "null", string(res))
+		assert.Equal(t, 9, cache.Len())
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		t.Parallel()
+
+		cache := NewCache(2)
+		a, err := cache.Compile(".a")
+		require.NoError(t, err)
+		_, err = cache.Compile(".b")
+		require.NoError(t, err)
+		// Use .a so that .b is evicted instead
+		_, err = cache.Compile(".a")
+		require.NoError(t, err)
+		_, err = cache.Compile(".c")
+		require.NoError(t, err)
+		assert.Equal(t, 2, cache.Len())
+
+		a2, err := cache.Compile(".a")
+		require.NoError(t, err)
+		assert.Same(t, a, a2)
+		b2, err := cache.Compile(".b")
+		require.NoError(t, err)
+		b3, err := cache.Compile(".b")
+		require.NoError(t, err)
+		assert.Same(t, b2, b3)
+		assert.Equal(t, 2, cache.Len())
+	})
+
+	t.Run("does not cache errors or functions", func(t *testing.T) {
+		t.Parallel()
+
+		cache := NewCache(10)
+		_, err := cache.Compile(".foo{")
+		require.Error(t, err)
+
+		identity := WithFunction("identity", 0, 0, func(v interface{}, _ []interface{}) interface{} { return v })
+		p1, err := cache.Compile("identity", identity)
+		require.NoError(t, err)
+		p2, err := cache.Compile("identity", identity)
+		require.NoError(t, err)
+		assert.NotSame(t, p1, p2)
+		assert.Equal(t, 0, cache.Len())
+	})
+}
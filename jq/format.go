@@ -0,0 +1,337 @@
+package jq
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a data format that queries can read input from and write results to.
+type Format int
+
+const (
+	// FormatJSON is JSON, the default format.
+	FormatJSON Format = iota
+	// FormatYAML is YAML. Input may contain multiple documents, and results are written
+	// as separate documents.
+	FormatYAML
+	// FormatTOML is TOML. Input is a single document, and only objects can be written.
+	FormatTOML
+	// FormatCBOR is CBOR, a binary format. Input may be a sequence of values, and results
+	// are written as a sequence of values.
+	FormatCBOR
+	// FormatMessagePack is MessagePack, a binary format. Input may be a sequence of
+	// values, and results are written as a sequence of values.
+	FormatMessagePack
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatYAML:
+		return "yaml"
+	case FormatTOML:
+		return "toml"
+	case FormatCBOR:
+		return "cbor"
+	case FormatMessagePack:
+		return "msgpack"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// binary indicates if the format is a binary format, which cannot be processed line by
+// line.
+func (f Format) binary() bool {
+	return f == FormatCBOR || f == FormatMessagePack
+}
+
+// WithInputFormat configures the format of the input data, which is JSON by default.
+// Values are converted to the same types as decoded JSON values, so numbers are handled
+// the same way as for JSON input, except that integers are retained as integers where
+// the format distinguishes them - including CBOR bignums, which are retained as
+// *big.Int. Timestamps are converted to RFC 3339 strings, and binary data is converted
+// to base64-encoded strings.
+//
+// Binary formats, such as FormatCBOR, cannot be used with Pipeline.
+func WithInputFormat(format Format) Option {
+	return func(o *options) { o.inputFormat = format }
+}
+
+// WithOutputFormat configures the format results are written in, which is JSON by
+// default. As with gojq's JSON output, numbers without a fractional part are written as
+// integers. Large integers are retained where the format supports them, and an error is
+// returned otherwise.
+//
+// Indentation configured with WithIndent or WithTab only applies to JSON and YAML. YAML
+// results are separated by a "---" document separator, unless WithSeparator is also
+// provided. Binary formats, such as FormatCBOR, cannot be used with Pipeline.
+func WithOutputFormat(format Format) Option {
+	return func(o *options) { o.outputFormat = format }
+}
+
+// valueDecoder decodes values one at a time, returning io.EOF when there are no more
+// values.
+type valueDecoder func() (interface{}, error)
+
+// newValueDecoder creates a decoder for values in format from r.
+func newValueDecoder(format Format, r io.Reader) valueDecoder {
+	switch format {
+	case FormatYAML:
+		dec := yaml.NewDecoder(r)
+		return func() (interface{}, error) {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, formatError(format, err)
+			}
+			return normalizeValue(v), nil
+		}
+
+	case FormatTOML:
+		var done bool
+		return func() (interface{}, error) {
+			if done {
+				return nil, io.EOF
+			}
+			done = true
+			var v map[string]interface{}
+			if _, err := toml.NewDecoder(r).Decode(&v); err != nil {
+				return nil, formatError(format, err)
+			}
+			return normalizeValue(v), nil
+		}
+
+	case FormatCBOR:
+		dec := cbor.NewDecoder(r)
+		return func() (interface{}, error) {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, formatError(format, err)
+			}
+			return normalizeValue(v), nil
+		}
+
+	case FormatMessagePack:
+		dec := msgpack.NewDecoder(r)
+		dec.UseLooseInterfaceDecoding(true)
+		return func() (interface{}, error) {
+			v, err := dec.DecodeInterface()
+			if err != nil {
+				return nil, formatError(format, err)
+			}
+			return normalizeValue(v), nil
+		}
+
+	default:
+		dec := json.NewDecoder(r)
+		return func() (interface{}, error) {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, formatError(FormatJSON, err)
+			}
+			return v, nil
+		}
+	}
+}
+
+// formatError prefixes err with the name of the format, unless it is io.EOF.
+func formatError(format Format, err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if strings.HasPrefix(err.Error(), format.String()+": ") {
+		return err
+	}
+	return fmt.Errorf("%s: %w", format, err)
+}
+
+// normalizeValue converts values decoded from formats other than JSON to the types
+// expected by gojq.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			v[k] = normalizeValue(x)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			m[fmt.Sprint(k)] = normalizeValue(x)
+		}
+		return m
+	case []interface{}:
+		for i, x := range v {
+			v[i] = normalizeValue(x)
+		}
+		return v
+	case []map[string]interface{}:
+		s := make([]interface{}, len(v))
+		for i, x := range v {
+			s[i] = normalizeValue(x)
+		}
+		return s
+	case big.Int:
+		return &v
+	case cbor.Tag:
+		return normalizeValue(v.Content)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	default:
+		// Other numeric types are normalized by gojq.
+		return v
+	}
+}
+
+// encodeValue writes v to output in format, which must not be FormatJSON.
+func encodeValue(format Format, output *bytes.Buffer, v interface{}, indent string) error {
+	switch format {
+	case FormatYAML:
+		v, err := convertNumbers(v, func(i *big.Int) (interface{}, error) {
+			// Omit the tag so that the integer is written as a plain scalar.
+			return &yaml.Node{Kind: yaml.ScalarNode, Value: i.String()}, nil
+		})
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		if indent != "" {
+			// YAML does not allow tabs for indentation.
+			enc.SetIndent(len(strings.ReplaceAll(indent, "\t", "    ")))
+		}
+		if err := enc.Encode(v); err != nil {
+			return formatError(format, err)
+		}
+		if err := enc.Close(); err != nil {
+			return formatError(format, err)
+		}
+		_, _ = output.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		return nil
+
+	case FormatTOML:
+		if _, ok := v.(map[string]interface{}); !ok {
+			return fmt.Errorf("%s: only objects can be written, got %s", format, typeName(v))
+		}
+		v, err := convertNumbers(v, bigIntToInt64)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+			return formatError(format, err)
+		}
+		_, _ = output.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+		return nil
+
+	case FormatCBOR:
+		// CBOR supports big integers natively.
+		v, err := convertNumbers(v, func(i *big.Int) (interface{}, error) { return i, nil })
+		if err != nil {
+			return err
+		}
+		em, err := cbor.EncOptions{Sort: cbor.SortBytewiseLexical}.EncMode()
+		if err != nil {
+			return formatError(format, err)
+		}
+		if err := em.NewEncoder(output).Encode(v); err != nil {
+			return formatError(format, err)
+		}
+		return nil
+
+	case FormatMessagePack:
+		v, err := convertNumbers(v, bigIntToInt64)
+		if err != nil {
+			return err
+		}
+		enc := msgpack.NewEncoder(output)
+		enc.SetSortMapKeys(true)
+		enc.UseCompactInts(true)
+		if err := enc.Encode(v); err != nil {
+			return formatError(format, err)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported output format %s", format)
+	}
+}
+
+// convertNumbers returns a copy of v where floats without a fractional part are
+// converted to integers, and *big.Int values are converted with convertBigInt.
+func convertNumbers(v interface{}, convertBigInt func(*big.Int) (interface{}, error)) (interface{}, error) {
+	switch v := v.(type) {
+	case float64:
+		// Only convert floats that can be represented exactly, like gojq.
+		if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+			return int64(v), nil
+		}
+		return v, nil
+	case *big.Int:
+		return convertBigInt(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			c, err := convertNumbers(x, convertBigInt)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = c
+		}
+		return m, nil
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, x := range v {
+			c, err := convertNumbers(x, convertBigInt)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = c
+		}
+		return s, nil
+	default:
+		return v, nil
+	}
+}
+
+// bigIntToInt64 converts i to an int64 for formats that do not support larger integers.
+func bigIntToInt64(i *big.Int) (interface{}, error) {
+	if !i.IsInt64() {
+		return nil, fmt.Errorf("integer %s is too large for the output format", i.String())
+	}
+	return i.Int64(), nil
+}
+
+// typeName returns the jq type name of v.
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,222 @@
+package jq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+func TestQueryFormats(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		query   string
+		opts    []Option
+		want    autogold.Value
+		wantErr autogold.Value
+	}{
+		{
+			name: "YAML documents",
+			input: `name: foo
+replicas: 3
+---
+name: bar
+replicas: 1.5
+created: 2023-01-02T03:04:05Z
+`,
+			query: "{name, replicas, created}",
+			opts:  []Option{WithInputFormat(FormatYAML), WithSeparator("\n")},
+			want: autogold.Expect(`{"created":null,"name":"foo","replicas":3}
+{"created":"2023-01-02T03:04:05Z","name":"bar","replicas":1.5}`),
+		},
+		{
+			name:    "invalid YAML",
+			input:   "foo: [",
+			query:   ".",
+			opts:    []Option{WithInputFormat(FormatYAML)},
+			wantErr: autogold.Expect("yaml: line 1: did not find expected node content"),
+		},
+		{
+			name: "TOML",
+			input: `title = "example"
+
+[[servers]]
+name = "alpha"
+port = 8080
+
+[[servers]]
+name = "beta"
+port = 8081
+`,
+			query: `.title, (.servers[] | "\(.name):\(.port)")`,
+			opts:  []Option{WithInputFormat(FormatTOML), WithRawOutput()},
+			want:  autogold.Expect("example\nalpha:8080\nbeta:8081"),
+		},
+		{
+			name:  "YAML output",
+			input: `{"name":"foo","tags":["a","b"]} {"name":"bar","tags":[]}`,
+			query: ".",
+			opts:  []Option{WithOutputFormat(FormatYAML)},
+			want: autogold.Expect(`name: foo
+tags:
+    - a
+    - b
+---
+name: bar
+tags: []`),
+		},
+		{
+			name:  "YAML output with indent and large integers",
+			input: `{"a":{"b":[1]}}`,
+			query: ".a.b += [123456789012345678901234567890, 1.5]",
+			opts:  []Option{WithOutputFormat(FormatYAML), WithIndent(2)},
+			want: autogold.Expect(`a:
+  b:
+    - 1
+    - 123456789012345678901234567890
+    - 1.5`),
+		},
+		{
+			name:  "TOML output",
+			input: `{"title":"example","owner":{"name":"robert","age":30}}`,
+			query: ".",
+			opts:  []Option{WithOutputFormat(FormatTOML)},
+			want: autogold.Expect(`title = "example"
+
+[owner]
+  age = 30
+  name = "robert"`),
+		},
+		{
+			name:    "TOML output of non-object",
+			input:   `[1, 2]`,
+			query:   ".",
+			opts:    []Option{WithOutputFormat(FormatTOML)},
+			wantErr: autogold.Expect("jq: toml: only objects can be written, got array"),
+		},
+		{
+			name:    "TOML output of large integer",
+			input:   `{"n": 1}`,
+			query:   ".n = 123456789012345678901234567890",
+			opts:    []Option{WithOutputFormat(FormatTOML)},
+			wantErr: autogold.Expect("jq: integer 123456789012345678901234567890 is too large for the output format"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			res, err := Query(strings.NewReader(tc.input), tc.query, tc.opts...)
+			if tc.wantErr != nil {
+				require.Error(t, err)
+				tc.wantErr.Equal(t, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			tc.want.Equal(t, string(res))
+		})
+	}
+}
+
+func TestQueryBinaryFormats(t *testing.T) {
+	t.Run("CBOR", func(t *testing.T) {
+		t.Parallel()
+
+		var input []byte
+		for _, v := range []interface{}{
+			map[string]interface{}{"id": 1, "data": []byte("hello")},
+			map[string]interface{}{"id": uint64(18446744073709551615), "data": []byte{}},
+		} {
+			b, err := cbor.Marshal(v)
+			require.NoError(t, err)
+			input = append(input, b...)
+		}
+
+		res, err := Query(strings.NewReader(string(input)), "{id: (.id + 1), data}",
+			WithInputFormat(FormatCBOR), WithSeparator("\n"))
+		require.NoError(t, err)
+		autogold.Expect(`{"data":"aGVsbG8=","id":2}
+{"data":"","id":18446744073709551616}`).Equal(t, string(res))
+
+		res, err = Query(strings.NewReader(string(input)), ".id + 1",
+			WithInputFormat(FormatCBOR), WithOutputFormat(FormatCBOR))
+		require.NoError(t, err)
+		dec := cbor.NewDecoder(strings.NewReader(string(res)))
+		var values []interface{}
+		for dec.NumBytesRead() < len(res) {
+			var v interface{}
+			require.NoError(t, dec.Decode(&v))
+			values = append(values, normalizeValue(v))
+		}
+		autogold.Expect("[2 18446744073709551616]").Equal(t, strings.TrimSpace(fmtValues(values)))
+	})
+
+	t.Run("MessagePack", func(t *testing.T) {
+		t.Parallel()
+
+		var input []byte
+		for _, v := range []interface{}{
+			map[string]interface{}{"level": "info", "latency": 1.5},
+			map[string]interface{}{"level": "error", "latency": int8(3)},
+		} {
+			b, err := msgpack.Marshal(v)
+			require.NoError(t, err)
+			input = append(input, b...)
+		}
+
+		res, err := Query(strings.NewReader(string(input)), "{level, ms: (.latency * 1000)}",
+			WithInputFormat(FormatMessagePack), WithOutputFormat(FormatMessagePack))
+		require.NoError(t, err)
+
+		dec := msgpack.NewDecoder(strings.NewReader(string(res)))
+		var values []interface{}
+		for i := 0; i < 2; i++ {
+			v, err := dec.DecodeInterfaceLoose()
+			require.NoError(t, err)
+			values = append(values, v)
+		}
+		autogold.Expect(`[map[level:info ms:1500] map[level:error ms:3000]]`).Equal(t, fmtValues(values))
+	})
+}
+
+func TestPipelineFormats(t *testing.T) {
+	t.Run("YAML", func(t *testing.T) {
+		t.Parallel()
+
+		p, err := BuildPipeline(context.Background(), "{name: .name, count: (.n + 1)}",
+			WithInputFormat(FormatYAML), WithOutputFormat(FormatYAML), WithNonJSON(pipeline.NonJSONPassthrough))
+		require.NoError(t, err)
+		lines, err := streamline.New(strings.NewReader("{name: foo, n: 1}\n# comment\n{name: bar, n: 2}")).
+			WithPipeline(p).
+			Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{
+			"count: 2", "name: foo", "# comment", "count: 3",
+			"name: bar",
+		}).Equal(t, lines)
+	})
+
+	t.Run("binary formats", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := BuildPipeline(context.Background(), ".", WithInputFormat(FormatCBOR))
+		require.Error(t, err)
+		autogold.Expect("jq: binary format cbor cannot be used in Pipeline").Equal(t, err.Error())
+
+		_, err = Pipeline(".", WithOutputFormat(FormatMessagePack)).ProcessLine([]byte("{}"))
+		assert.Error(t, err)
+	})
+}
+
+func fmtValues(values []interface{}) string {
+	return strings.TrimSpace(strings.ReplaceAll(fmt.Sprint(values), "\n", " "))
+}
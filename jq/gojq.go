@@ -9,27 +9,49 @@ import (
 	"github.com/itchyny/gojq"
 )
 
-// buildJQ parses and compiles a jq query.
-func buildJQ(query string) (*gojq.Code, error) {
+// buildJQ parses and compiles a jq query. Values for extraVariables must be provided
+// when running the query.
+func buildJQ(query string, o *options, extraVariables ...string) (*Program, error) {
 	jq, err := gojq.Parse(query)
 	if err != nil {
 		return nil, fmt.Errorf("jq.Parse: %w", err)
 	}
-	jqCode, err := gojq.Compile(jq)
+	names, values := o.variables()
+	names = append(names, extraVariables...)
+	jqCode, err := gojq.Compile(jq, o.compilerOptions(names)...)
 	if err != nil {
 		return nil, fmt.Errorf("jq.Compile: %w", err)
 	}
-	return jqCode, nil
+	return &Program{
+		query:  query,
+		opts:   o,
+		code:   jqCode,
+		values: values,
+	}, nil
 }
 
-// execJQ executes the compiled jq query against content from reader.
-func execJQ(ctx context.Context, jqCode *gojq.Code, data []byte, output *bytes.Buffer) error {
-	var input interface{}
-	if err := json.Unmarshal(data, &input); err != nil {
-		return fmt.Errorf("json: %w", err)
-	}
+// runJQ executes the compiled jq query against a decoded input value, writing results
+// with enc.
+func runJQ(ctx context.Context, jqCode *Program, input interface{}, enc *resultEncoder) error {
+	return eachJQ(ctx, jqCode, input, nil, func(v interface{}) error {
+		if err := enc.encode(v); err != nil {
+			return fmt.Errorf("jq: %w", err)
+		}
+		return nil
+	})
+}
 
-	iter := jqCode.RunWithContext(ctx, input)
+// eachJQ executes the compiled jq query against a decoded input value, calling fn with
+// each result. extraValues are the values of extra variables the query was built with.
+func eachJQ(ctx context.Context, jqCode *Program, input interface{}, extraValues []interface{}, fn func(v interface{}) error) error {
+	// gojq normalizes variable values in place, so each run needs its own copy for the
+	// Program to be safe for concurrent use.
+	values := make([]interface{}, len(jqCode.values), len(jqCode.values)+len(extraValues))
+	for i, v := range jqCode.values {
+		values[i] = copyValue(v)
+	}
+	values = append(values, extraValues...)
+	iter := jqCode.code.RunWithContext(ctx, input, values...)
 	for {
 		// See https://github.com/itchyny/gojq#usage-as-a-library for how to use the
 		// iterator.
@@ -40,13 +62,95 @@ func execJQ(ctx context.Context, jqCode *gojq.Code, data []byte, output *bytes.B
 		if err, ok := v.(error); ok {
 			return fmt.Errorf("jq: %w", err)
 		}
-		encoded, err := gojq.Marshal(v)
-		if err != nil {
-			return fmt.Errorf("jq: %w", err)
+		if err := fn(v); err != nil {
+			return err
 		}
-
-		// Buffer writes will never error.
-		_, _ = output.Write(encoded)
 	}
 	return nil
 }
+
+// copyValue returns a deep copy of arrays and objects in v.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, x := range v {
+			c[i] = copyValue(x)
+		}
+		return c
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, x := range v {
+			c[k] = copyValue(x)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// resultEncoder writes jq results to output according to the configured output options.
+type resultEncoder struct {
+	output *bytes.Buffer
+
+	format    Format
+	rawOutput bool
+	indent    string
+	separator string
+	skipNull  bool
+
+	// written indicates if a result has been written since the last reset, to determine
+	// if a separator is needed.
+	written bool
+}
+
+func newResultEncoder(o *options, output *bytes.Buffer) *resultEncoder {
+	separator := o.separator
+	if o.outputFormat == FormatYAML && separator == "" {
+		separator = "\n---\n"
+	}
+	return &resultEncoder{
+		output:    output,
+		format:    o.outputFormat,
+		rawOutput: o.rawOutput,
+		indent:    o.indent,
+		separator: separator,
+		skipNull:  o.skipEmpty,
+	}
+}
+
+// reset clears the output buffer.
+func (e *resultEncoder) reset() {
+	e.output.Reset()
+	e.written = false
+}
+
+func (e *resultEncoder) encode(v interface{}) error {
+	if v == nil && e.skipNull {
+		return nil
+	}
+
+	// Buffer writes will never error.
+	if e.written {
+		_, _ = e.output.WriteString(e.separator)
+	}
+	e.written = true
+
+	if s, ok := v.(string); ok && e.rawOutput {
+		_, _ = e.output.WriteString(s)
+		return nil
+	}
+	if e.format != FormatJSON {
+		return encodeValue(e.format, e.output, v, e.indent)
+	}
+	encoded, err := gojq.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if e.indent == "" {
+		_, _ = e.output.Write(encoded)
+		return nil
+	}
+	// json.Indent retains the formatting of numbers and strings from gojq.Marshal.
+	return json.Indent(e.output, encoded, "", e.indent)
+}
@@ -0,0 +1,232 @@
+package jq
+
+import (
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// Option configures the behaviour of queries and pipelines created by this package.
+type Option func(*options)
+
+type options struct {
+	// slurp indicates that all input values should be collected into an array and
+	// provided to the query as a single value.
+	slurp bool
+
+	// inputFormat and outputFormat are the formats of input and results.
+	inputFormat  Format
+	outputFormat Format
+
+	// rawOutput indicates that string results should be written without JSON encoding.
+	rawOutput bool
+	// indent is used to pretty-print results if non-empty.
+	indent string
+	// separator is written between results.
+	separator string
+
+	// variableNames and variableValues are the names, including the leading '$', and
+	// values of variables available to the query.
+	variableNames  []string
+	variableValues []interface{}
+	// environ is the environment available to the query as $ENV.
+	environ []string
+	// modulePaths are the paths searched for modules imported by the query.
+	modulePaths []string
+	// functions are custom functions available to the query.
+	functions []function
+
+	// nonJSON configures how Pipeline handles lines that are not valid JSON.
+	nonJSON pipeline.NonJSONPolicy
+	// skipEmpty indicates that null results should be omitted, and lines without any
+	// results skipped.
+	skipEmpty bool
+
+	// cache is used to retrieve compiled queries if non-nil.
+	cache *Cache
+}
+
+// function is a custom function implemented in Go.
+type function struct {
+	name               string
+	minArity, maxArity int
+	fn                 func(interface{}, []interface{}) interface{}
+}
+
+// variables returns the names and values of all variables available to the query,
+// including $ARGS, which is always available similar to jq.
+func (o *options) variables() ([]string, []interface{}) {
+	named := make(map[string]interface{}, len(o.variableNames))
+	for i, name := range o.variableNames {
+		named[strings.TrimPrefix(name, "$")] = o.variableValues[i]
+	}
+	names := append(append([]string{}, o.variableNames...), "$ARGS")
+	values := append(append([]interface{}{}, o.variableValues...), map[string]interface{}{
+		"named":      named,
+		"positional": []interface{}{},
+	})
+	return names, values
+}
+
+// compilerOptions returns the gojq compiler options for building queries with the given
+// variable names.
+func (o *options) compilerOptions(variableNames []string) []gojq.CompilerOption {
+	compilerOpts := []gojq.CompilerOption{
+		gojq.WithVariables(variableNames),
+	}
+	if o.environ != nil {
+		environ := o.environ
+		compilerOpts = append(compilerOpts, gojq.WithEnvironLoader(func() []string { return environ }))
+	}
+	if len(o.modulePaths) > 0 {
+		compilerOpts = append(compilerOpts, gojq.WithModuleLoader(gojq.NewModuleLoader(o.modulePaths)))
+	}
+	for _, f := range o.functions {
+		compilerOpts = append(compilerOpts, gojq.WithFunction(f.name, f.minArity, f.maxArity, f.fn))
+	}
+	return compilerOpts
+}
+
+func buildOptions(opts []Option) *options {
+	o := &options{nonJSON: pipeline.NonJSONError}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSlurp configures Query to collect all JSON values in the input into a single
+// array, and run the query once against the array, similar to 'jq --slurp'. It has no
+// effect on Pipeline, which always runs the query against each line.
+func WithSlurp() Option {
+	return func(o *options) { o.slurp = true }
+}
+
+// WithRawOutput configures string results to be written directly rather than as
+// JSON-encoded strings, and results to be separated by newlines, similar to
+// 'jq --raw-output'. Results that are not strings are still JSON-encoded.
+func WithRawOutput() Option {
+	return func(o *options) {
+		o.rawOutput = true
+		o.separator = "\n"
+	}
+}
+
+// WithJoinOutput is the same as WithRawOutput, but results are not separated, similar
+// to 'jq --join-output'.
+func WithJoinOutput() Option {
+	return func(o *options) {
+		o.rawOutput = true
+		o.separator = ""
+	}
+}
+
+// WithCompactOutput configures results to be written as compact JSON, similar to
+// 'jq --compact-output'. This is the default.
+func WithCompactOutput() Option {
+	return func(o *options) { o.indent = "" }
+}
+
+// WithIndent configures results to be pretty-printed with the given number of spaces
+// for indentation, similar to 'jq --indent n'. If n is 0, results are written as
+// compact JSON.
+func WithIndent(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			n = 0
+		}
+		o.indent = strings.Repeat(" ", n)
+	}
+}
+
+// WithTab configures results to be pretty-printed with tabs for indentation, similar to
+// 'jq --tab'.
+func WithTab() Option {
+	return func(o *options) { o.indent = "\t" }
+}
+
+// WithSeparator configures the separator written between results. By default, results
+// are not separated. For example, use "\n" to write each result on its own line - in
+// Pipeline, this causes each result to be emitted as a separate line - or "\x00" for
+// NUL-separated results. To set a separator for raw output, provide WithSeparator after
+// WithRawOutput, for example to get results similar to 'jq --raw-output0'.
+func WithSeparator(separator string) Option {
+	return func(o *options) { o.separator = separator }
+}
+
+// WithVariable makes value available to the query as the variable $name, similar to
+// 'jq --arg name value' for strings or 'jq --argjson name value' for other values. This
+// allows queries to be parameterised without building query strings from user input.
+// The leading '$' in name is optional.
+//
+// Values must be of the types produced by decoding JSON into an interface{}: nil, bool,
+// float64, string, []interface{} and map[string]interface{}, or int and *big.Int for
+// numbers.
+//
+// All variables are also available to the query as $ARGS.named. Referencing a variable
+// that has not been provided is reported as an error when building the query.
+func WithVariable(name string, value interface{}) Option {
+	if !strings.HasPrefix(name, "$") {
+		name = "$" + name
+	}
+	return func(o *options) {
+		for i, existing := range o.variableNames {
+			if existing == name {
+				o.variableValues[i] = value
+				return
+			}
+		}
+		o.variableNames = append(o.variableNames, name)
+		o.variableValues = append(o.variableValues, value)
+	}
+}
+
+// WithEnviron makes the given environment, in the "key=value" form returned by
+// os.Environ, available to the query as $ENV and env. By default, the environment
+// available to the query is empty - to expose the environment of the current process,
+// use WithEnviron(os.Environ()).
+func WithEnviron(environ []string) Option {
+	return func(o *options) {
+		o.environ = append([]string{}, environ...)
+	}
+}
+
+// WithModulePaths configures the paths to search for modules imported by the query, for
+// example with 'import "foo" as foo;', similar to 'jq -L path'. By default, modules
+// cannot be imported.
+func WithModulePaths(paths ...string) Option {
+	return func(o *options) {
+		o.modulePaths = append(o.modulePaths, paths...)
+	}
+}
+
+// WithFunction makes a function implemented in Go available to the query with the given
+// name and number of arguments. fn is called with the input value and the evaluated
+// arguments, and should return a value of the same types as supported by WithVariable,
+// or an error. See gojq.WithFunction for more details.
+func WithFunction(name string, minArity, maxArity int, fn func(input interface{}, args []interface{}) interface{}) Option {
+	return func(o *options) {
+		o.functions = append(o.functions, function{
+			name:     name,
+			minArity: minArity,
+			maxArity: maxArity,
+			fn:       fn,
+		})
+	}
+}
+
+// WithNonJSON configures how Pipeline handles lines that are not valid JSON, such as
+// plain-text output mixed with JSON logs. By default, Pipeline returns an error with the
+// line (pipeline.NonJSONError). With pipeline.NonJSONWrap, the query is run against
+// {"raw": "..."} instead - see pipeline.WrapNonJSON. It has no effect on Query.
+func WithNonJSON(policy pipeline.NonJSONPolicy) Option {
+	return func(o *options) { o.nonJSON = policy }
+}
+
+// WithSkipEmpty configures null results to be omitted from the output. In Pipeline,
+// lines where the query produces no results, for example with 'empty' or 'select', or
+// only null results, are skipped entirely instead of being emitted as empty lines.
+func WithSkipEmpty() Option {
+	return func(o *options) { o.skipEmpty = true }
+}
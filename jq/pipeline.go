@@ -3,9 +3,11 @@ package jq
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 
-	"github.com/itchyny/gojq"
 	"go.bobheadxi.dev/streamline/pipeline"
 )
 
@@ -14,15 +16,25 @@ import (
 // pipeline that returns an error immediately on read - to handle query build errors, use
 // BuildPipeline instead.
 //
+// By default, all results of the query against a line are written as compact JSON with
+// no separator on a single line. Output can be configured with options like
+// WithRawOutput and WithIndent - if results are separated by newlines, for example with
+// WithSeparator("\n"), each result is emitted as a separate line.
+//
+// By default, lines that are not valid JSON cause the pipeline to error - this can be
+// configured with WithNonJSON. Empty lines are always retained as-is. To process JSON
+// values that span multiple lines, such as pretty-printed JSON, use
+// pipeline.ReassembleJSON before Pipeline.
+//
 // Internally, Pipeline uses github.com/itchyny/gojq to build and run the query.
-func Pipeline(query string) pipeline.Pipeline {
-	return PipelineContext(context.Background(), query)
+func Pipeline(query string, opts ...Option) pipeline.Pipeline {
+	return PipelineContext(context.Background(), query, opts...)
 }
 
 // PipelineContext is the same as Pipeline, but runs the generated JQ code in the given
 // context.
-func PipelineContext(ctx context.Context, query string) pipeline.Pipeline {
-	p, err := BuildPipeline(ctx, query)
+func PipelineContext(ctx context.Context, query string, opts ...Option) pipeline.Pipeline {
+	p, err := BuildPipeline(ctx, query, opts...)
 	if err != nil {
 		return pipeline.MapErr(func(line []byte) ([]byte, error) { return nil, err })
 	}
@@ -34,22 +46,21 @@ func PipelineContext(ctx context.Context, query string) pipeline.Pipeline {
 // code is run in the given context.
 //
 // Internally, BuildPipeline uses github.com/itchyny/gojq to build and run the query.
-func BuildPipeline(ctx context.Context, query string) (pipeline.Pipeline, error) {
-	jqCode, err := buildJQ(query)
+func BuildPipeline(ctx context.Context, query string, opts ...Option) (pipeline.Pipeline, error) {
+	p, err := compile(query, buildOptions(opts))
 	if err != nil {
 		return nil, err
 	}
-	return &jqCodePipeline{
-		ctx:          ctx,
-		code:         jqCode,
-		resultBuffer: &bytes.Buffer{},
-	}, nil
+	if err := p.pipelineError(); err != nil {
+		return nil, err
+	}
+	return p.PipelineContext(ctx), nil
 }
 
 type jqCodePipeline struct {
-	ctx          context.Context
-	code         *gojq.Code
-	resultBuffer *bytes.Buffer
+	ctx    context.Context
+	code   *Program
+	result *resultEncoder
 }
 
 func (p *jqCodePipeline) ProcessLine(line []byte) ([]byte, error) {
@@ -59,13 +70,46 @@ func (p *jqCodePipeline) ProcessLine(line []byte) ([]byte, error) {
 
 	// Reset buffer - by the time a new line is processed, nobody should be
 	// holding a reference to the previous results.
-	p.resultBuffer.Reset()
+	p.result.reset()
 
-	// Run code, populating resultBuffer with the output
-	err := execJQ(p.ctx, p.code, line, p.resultBuffer)
+	input, err := decodeLine(p.code.opts.inputFormat, line)
 	if err != nil {
+		switch p.code.opts.nonJSON {
+		case pipeline.NonJSONPassthrough:
+			return line, nil
+		case pipeline.NonJSONSkip:
+			return nil, nil
+		case pipeline.NonJSONWrap:
+			input = pipeline.WrapNonJSON(line)
+		default:
+			// Embed the consumed content for ease of debugging
+			return nil, fmt.Errorf("%w: %s", err, string(line))
+		}
+	}
+
+	// Run code, populating the result buffer with the output
+	if err := runJQ(p.ctx, p.code, input, p.result); err != nil {
 		// Embed the consumed content for ease of debugging
 		return nil, fmt.Errorf("%w: %s", err, string(line))
 	}
-	return p.resultBuffer.Bytes(), nil
+	if p.code.opts.skipEmpty && !p.result.written {
+		return nil, nil
+	}
+	return p.result.output.Bytes(), nil
+}
+
+// decodeLine decodes line in the input format.
+func decodeLine(format Format, line []byte) (interface{}, error) {
+	if format == FormatJSON {
+		var input interface{}
+		if err := json.Unmarshal(line, &input); err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+		return input, nil
+	}
+	input, err := newValueDecoder(format, bytes.NewReader(line))()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: no value found", format)
+	}
+	return input, err
 }
@@ -1,11 +1,15 @@
 package jq
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/hexops/autogold/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipeline"
 )
 
 func TestPipeline(t *testing.T) {
@@ -62,3 +66,134 @@ func TestPipeline(t *testing.T) {
 		assert.Equal(t, ``, string(l))
 	})
 }
+
+func TestPipelineOutput(t *testing.T) {
+	input := `{"foo":"bar","baz":[1,2]}
+{"foo":"hello","baz":[3]}`
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		opts  []Option
+		want  autogold.Value
+	}{
+		{
+			name:  "default",
+			query: ".foo, .baz",
+			want:  autogold.Expect([]string{`"bar"[1,2]`, `"hello"[3]`}),
+		},
+		{
+			name:  "raw output",
+			query: ".foo, .baz",
+			opts:  []Option{WithRawOutput()},
+			want:  autogold.Expect([]string{"bar", "[1,2]", "hello", "[3]"}),
+		},
+		{
+			name:  "join output",
+			query: ".foo, .baz",
+			opts:  []Option{WithJoinOutput()},
+			want:  autogold.Expect([]string{"bar[1,2]", "hello[3]"}),
+		},
+		{
+			name:  "separator",
+			query: ".baz[]",
+			opts:  []Option{WithSeparator(",")},
+			want:  autogold.Expect([]string{"1,2", "3"}),
+		},
+		{
+			name:  "indent",
+			query: "{foo}",
+			opts:  []Option{WithIndent(1)},
+			want:  autogold.Expect([]string{"{", ` "foo": "bar"`, "}", "{", ` "foo": "hello"`, "}"}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			p, err := BuildPipeline(context.Background(), tc.query, tc.opts...)
+			require.NoError(t, err)
+
+			lines, err := streamline.New(strings.NewReader(input)).WithPipeline(p).Lines()
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+}
+
+func TestPipelineNonJSON(t *testing.T) {
+	input := `starting server...
+{"level":"info","msg":"listening"}
+{"level":"debug"}
+
+panic: oh no
+{"level":"error","msg":"crashed"}`
+
+	for _, tc := range []struct {
+		name    string
+		query   string
+		opts    []Option
+		want    autogold.Value
+		wantErr autogold.Value
+	}{
+		{
+			name:    "default",
+			query:   ".msg",
+			wantErr: autogold.Expect("json: invalid character 's' looking for beginning of value: starting server..."),
+		},
+		{
+			name:  "passthrough",
+			query: ".msg",
+			opts:  []Option{WithNonJSON(pipeline.NonJSONPassthrough)},
+			want: autogold.Expect([]string{
+				"starting server...", `"listening"`, "null", "",
+				"panic: oh no",
+				`"crashed"`,
+			}),
+		},
+		{
+			name:  "skip",
+			query: ".msg",
+			opts:  []Option{WithNonJSON(pipeline.NonJSONSkip), WithRawOutput()},
+			want:  autogold.Expect([]string{"listening", "null", "", "crashed"}),
+		},
+		{
+			name:  "wrap",
+			query: ".msg // .raw",
+			opts:  []Option{WithNonJSON(pipeline.NonJSONWrap), WithRawOutput()},
+			want: autogold.Expect([]string{
+				"starting server...", "listening", "null", "",
+				"panic: oh no",
+				"crashed",
+			}),
+		},
+		{
+			name:  "skip empty",
+			query: ".msg",
+			opts:  []Option{WithNonJSON(pipeline.NonJSONSkip), WithSkipEmpty()},
+			want:  autogold.Expect([]string{`"listening"`, "", `"crashed"`}),
+		},
+		{
+			name:  "skip empty with select",
+			query: `select(.raw | test("panic")?) | .raw, null`,
+			opts:  []Option{WithNonJSON(pipeline.NonJSONWrap), WithSkipEmpty(), WithRawOutput()},
+			want:  autogold.Expect([]string{"", "panic: oh no"}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			lines, err := streamline.New(strings.NewReader(input)).
+				WithPipeline(Pipeline(tc.query, tc.opts...)).
+				Lines()
+			if tc.wantErr != nil {
+				require.Error(t, err)
+				tc.wantErr.Equal(t, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+}
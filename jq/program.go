@@ -0,0 +1,112 @@
+package jq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/itchyny/gojq"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// Program is a compiled JQ query. A Program can be used concurrently to run the query
+// with Query or Pipeline any number of times, avoiding the cost of parsing and compiling
+// the query each time.
+type Program struct {
+	query string
+	opts  *options
+
+	code *gojq.Code
+	// values are the values of the variables the query was compiled with.
+	values []interface{}
+}
+
+// Compile parses and compiles a JQ query with the given options into a Program. If
+// WithCache is provided, the Program is retrieved from or added to the cache.
+//
+// Internally, Compile uses github.com/itchyny/gojq to build the query.
+func Compile(query string, opts ...Option) (*Program, error) {
+	return compile(query, buildOptions(opts))
+}
+
+func compile(query string, o *options) (*Program, error) {
+	if o.cache != nil {
+		return o.cache.compile(query, o)
+	}
+	return buildJQ(query, o)
+}
+
+// String returns the query the Program was compiled from.
+func (p *Program) String() string { return p.query }
+
+// Query runs the Program against data - see the package-level Query for more details.
+func (p *Program) Query(data io.Reader) ([]byte, error) {
+	return p.QueryContext(context.Background(), data)
+}
+
+// QueryContext is the same as Query, but runs the Program in the given context.
+func (p *Program) QueryContext(ctx context.Context, data io.Reader) ([]byte, error) {
+	var output bytes.Buffer
+	enc := newResultEncoder(p.opts, &output)
+	var slurped []interface{}
+	decode := newValueDecoder(p.opts.inputFormat, data)
+	for {
+		input, err := decode()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if p.opts.slurp {
+			slurped = append(slurped, input)
+			continue
+		}
+		if err := runJQ(ctx, p, input, enc); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.opts.slurp {
+		if slurped == nil {
+			slurped = []interface{}{}
+		}
+		if err := runJQ(ctx, p, slurped, enc); err != nil {
+			return nil, err
+		}
+	}
+
+	return output.Bytes(), nil
+}
+
+// Pipeline returns a pipeline that runs the Program against each line - see the
+// package-level Pipeline for more details. Each pipeline returned can only be used by
+// one stream at a time, but any number of pipelines can be created from the same Program.
+func (p *Program) Pipeline() pipeline.Pipeline {
+	return p.PipelineContext(context.Background())
+}
+
+// PipelineContext is the same as Pipeline, but runs the Program in the given context.
+func (p *Program) PipelineContext(ctx context.Context) pipeline.Pipeline {
+	if err := p.pipelineError(); err != nil {
+		return pipeline.MapErr(func(line []byte) ([]byte, error) { return nil, err })
+	}
+	return &jqCodePipeline{
+		ctx:    ctx,
+		code:   p,
+		result: newResultEncoder(p.opts, &bytes.Buffer{}),
+	}
+}
+
+// pipelineError returns an error if the Program cannot be used in a Pipeline.
+func (p *Program) pipelineError() error {
+	for _, format := range []Format{p.opts.inputFormat, p.opts.outputFormat} {
+		if format.binary() {
+			return fmt.Errorf("jq: binary format %s cannot be used in Pipeline", format)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package jq
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+)
+
+func TestCompile(t *testing.T) {
+	t.Run("invalid query", func(t *testing.T) {
+		t.Parallel()
+
+		p, err := Compile(".foo{")
+		assert.Nil(t, p)
+		require.Error(t, err)
+		autogold.Expect(`jq.Parse: unexpected token "{"`).Equal(t, err.Error())
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		t.Parallel()
+
+		p, err := Compile(".n * $m.n", WithVariable("m", map[string]interface{}{"n": 2}), WithSeparator(" "))
+		require.NoError(t, err)
+		assert.Equal(t, ".n * $m.n", p.String())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+
+				res, err := p.Query(strings.NewReader(fmt.Sprintf(`{"n":%d} {"n":1}`, i)))
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("%d 2", i*2), string(res))
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+
+				lines, err := streamline.New(strings.NewReader(fmt.Sprintf("{\"n\":%d}\n{\"n\":1}", i))).
+					WithPipeline(p.Pipeline()).
+					Lines()
+				assert.NoError(t, err)
+				assert.Equal(t, []string{fmt.Sprint(i * 2), "2"}, lines)
+			}(i)
+		}
+		wg.Wait()
+	})
+}
@@ -1,7 +1,6 @@
 package jq
 
 import (
-	"bytes"
 	"context"
 	"io"
 )
@@ -9,26 +8,24 @@ import (
 // Query is a utility for building and executing a JQ query against some data, such as a
 // streamline.Stream instance.
 //
+// The data may contain a sequence of JSON values, such as JSON lines or concatenated JSON
+// documents, which are decoded one at a time - the query is run against each value in
+// turn. To run the query once against an array of all the values instead, use
+// WithSlurp. By default, results are written as compact JSON with no separator between
+// results - output can be configured with options like WithRawOutput and WithSeparator.
+//
+// To run the same query many times, use Compile to build a reusable Program instead.
+//
 // Internally, Query uses github.com/itchyny/gojq to build and run the query.
-func Query(data io.Reader, query string) ([]byte, error) {
-	return QueryContext(context.Background(), data, query)
+func Query(data io.Reader, query string, opts ...Option) ([]byte, error) {
+	return QueryContext(context.Background(), data, query, opts...)
 }
 
 // QueryContext is the same as Query, but runs the generated JQ code in the given context.
-func QueryContext(ctx context.Context, data io.Reader, query string) ([]byte, error) {
-	jqCode, err := buildJQ(query)
+func QueryContext(ctx context.Context, data io.Reader, query string, opts ...Option) ([]byte, error) {
+	p, err := compile(query, buildOptions(opts))
 	if err != nil {
 		return nil, err
 	}
-
-	var b bytes.Buffer
-	if _, err := io.Copy(&b, data); err != nil {
-		return nil, err
-	}
-
-	var output bytes.Buffer
-	if err := execJQ(ctx, jqCode, b.Bytes(), &output); err != nil {
-		return nil, err
-	}
-	return output.Bytes(), nil
+	return p.QueryContext(ctx, data)
 }
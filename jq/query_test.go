@@ -1,10 +1,15 @@
 package jq
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/hexops/autogold/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.bobheadxi.dev/streamline"
 )
 
@@ -31,3 +36,244 @@ func TestQuery(t *testing.T) {
 		assert.Equal(t, `"bar"`, string(res))
 	})
 }
+
+func TestQueryMultipleValues(t *testing.T) {
+	t.Run("JSON lines", func(t *testing.T) {
+		t.Parallel()
+
+		s := streamline.New(strings.NewReader(`{"foo":1}
+{"foo":2}
+{"foo":3}`))
+		res, err := Query(s, ".foo * 2")
+		assert.NoError(t, err)
+		assert.Equal(t, `246`, string(res))
+	})
+
+	t.Run("concatenated documents", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := Query(strings.NewReader(`{"foo":"a"}{"foo":"b"} [1, 2]`), ".[0]?")
+		assert.NoError(t, err)
+		assert.Equal(t, `1`, string(res))
+	})
+
+	t.Run("slurp", func(t *testing.T) {
+		t.Parallel()
+
+		s := streamline.New(strings.NewReader(`{"foo":1}
+{"foo":2}
+{"foo":3}`))
+		res, err := Query(s, "map(.foo) | add", WithSlurp())
+		assert.NoError(t, err)
+		assert.Equal(t, `6`, string(res))
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := Query(strings.NewReader(""), ".")
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+
+		res, err = Query(strings.NewReader(" \n"), "length", WithSlurp())
+		assert.NoError(t, err)
+		assert.Equal(t, `0`, string(res))
+	})
+
+	t.Run("invalid value after valid values", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := Query(strings.NewReader(`{"foo":1} {"foo":`), ".foo")
+		assert.Error(t, err)
+		assert.Equal(t, "json: unexpected EOF", err.Error())
+		assert.Empty(t, res)
+	})
+}
+
+func TestQueryOutput(t *testing.T) {
+	const input = `{"foo":"bar","baz":[1,2.5]}
+{"foo":"hello\nworld","baz":[]}`
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		opts  []Option
+		want  autogold.Value
+	}{
+		{
+			name:  "default",
+			query: ".foo",
+			want:  autogold.Expect(`"bar""hello\nworld"`),
+		},
+		{
+			name:  "raw output",
+			query: ".foo, .baz",
+			opts:  []Option{WithRawOutput()},
+			want:  autogold.Expect("bar\n[1,2.5]\nhello\nworld\n[]"),
+		},
+		{
+			name:  "join output",
+			query: ".foo, .baz",
+			opts:  []Option{WithJoinOutput()},
+			want:  autogold.Expect("bar[1,2.5]hello\nworld[]"),
+		},
+		{
+			name:  "raw output with NUL separator",
+			query: ".foo",
+			opts:  []Option{WithRawOutput(), WithSeparator("\x00")},
+			want:  autogold.Expect("bar\x00hello\nworld"),
+		},
+		{
+			name:  "compact with newline separator",
+			query: ".",
+			opts:  []Option{WithSeparator("\n")},
+			want: autogold.Expect(`{"baz":[1,2.5],"foo":"bar"}
+{"baz":[],"foo":"hello\nworld"}`),
+		},
+		{
+			name:  "indent",
+			query: ".baz",
+			opts:  []Option{WithIndent(2), WithSeparator("\n")},
+			want: autogold.Expect(`[
+  1,
+  2.5
+]
+[]`),
+		},
+		{
+			name:  "tab",
+			query: "{foo}",
+			opts:  []Option{WithTab()},
+			want:  autogold.Expect("{\n\t\"foo\": \"bar\"\n}{\n\t\"foo\": \"hello\\nworld\"\n}"),
+		},
+		{
+			name:  "compact after indent",
+			query: "{foo}",
+			opts:  []Option{WithTab(), WithCompactOutput()},
+			want:  autogold.Expect(`{"foo":"bar"}{"foo":"hello\nworld"}`),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			res, err := Query(strings.NewReader(input), tc.query, tc.opts...)
+			require.NoError(t, err)
+			tc.want.Equal(t, string(res))
+		})
+	}
+}
+
+func TestQueryCompilerOptions(t *testing.T) {
+	modules := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(modules, "greet.jq"),
+		[]byte(`def greet(name): "hello " + name;`), 0o644))
+
+	for _, tc := range []struct {
+		name    string
+		query   string
+		opts    []Option
+		want    autogold.Value
+		wantErr autogold.Value
+	}{
+		{
+			name:  "variables",
+			query: `select(.user == $user) | .n + $offset`,
+			opts: []Option{
+				WithVariable("user", "robert"),
+				WithVariable("$offset", 10),
+			},
+			want: autogold.Expect("11"),
+		},
+		{
+			name:  "variables are not evaluated",
+			query: `select(.user == $user) | .n`,
+			opts:  []Option{WithVariable("user", `robert" or true`)},
+			want:  autogold.Expect(""),
+		},
+		{
+			name:  "overwritten variable",
+			query: `$v`,
+			opts:  []Option{WithVariable("v", 1), WithVariable("v", 2)},
+			want:  autogold.Expect("22"),
+		},
+		{
+			name:  "named arguments",
+			query: `$ARGS`,
+			opts:  []Option{WithVariable("a", "b"), WithSlurp()},
+			want:  autogold.Expect(`{"named":{"a":"b"},"positional":[]}`),
+		},
+		{
+			name:    "unknown variable",
+			query:   `.user == $user`,
+			wantErr: autogold.Expect("jq.Compile: variable not defined: $user"),
+		},
+		{
+			name:  "default environment",
+			query: `$ENV | length`,
+			opts:  []Option{WithSlurp()},
+			want:  autogold.Expect("0"),
+		},
+		{
+			name:  "environment",
+			query: `$ENV.USER + " " + env.HOME`,
+			opts:  []Option{WithEnviron([]string{"USER=robert", "HOME=/home/robert", "invalid"}), WithSlurp()},
+			want:  autogold.Expect(`"robert /home/robert"`),
+		},
+		{
+			name:  "modules",
+			query: `import "greet" as g; g::greet(.user)`,
+			opts:  []Option{WithModulePaths(modules), WithJoinOutput()},
+			want:  autogold.Expect("hello roberthello alice"),
+		},
+		{
+			name:    "modules not configured",
+			query:   `import "greet" as g; g::greet(.user)`,
+			wantErr: autogold.Expect(`jq.Compile: cannot load module: "greet"`),
+		},
+		{
+			name:  "function",
+			query: `.user | initial, initial(2)`,
+			opts: []Option{
+				WithFunction("initial", 0, 1, func(input interface{}, args []interface{}) interface{} {
+					s, ok := input.(string)
+					if !ok {
+						return fmt.Errorf("initial: expected a string but got %T", input)
+					}
+					n := 1
+					if len(args) > 0 {
+						n = args[0].(int)
+					}
+					return s[:n]
+				}),
+				WithRawOutput(),
+			},
+			want: autogold.Expect("r\nro\na\nal"),
+		},
+		{
+			name:  "function error",
+			query: `initial`,
+			opts: []Option{
+				WithFunction("initial", 0, 0, func(input interface{}, args []interface{}) interface{} {
+					return fmt.Errorf("initial: expected a string but got %T", input)
+				}),
+			},
+			wantErr: autogold.Expect("jq: initial: expected a string but got map[string]interface {}"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			res, err := Query(strings.NewReader(`{"user":"robert","n":1}
+{"user":"alice","n":2}`), tc.query, tc.opts...)
+			if tc.wantErr != nil {
+				require.Error(t, err)
+				tc.wantErr.Equal(t, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			tc.want.Equal(t, string(res))
+		})
+	}
+}
@@ -0,0 +1,493 @@
+package jq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+)
+
+// Validation is the result of validating a query with Validate.
+type Validation struct {
+	// Diagnostics lists problems with the query. The query is valid if there are no
+	// diagnostics.
+	Diagnostics []Diagnostic
+	// Paths lists the paths referenced in the query, such as ".foo.bar" or ".items[]",
+	// sorted and deduplicated. Paths are as written in the query, relative to the input
+	// of the expression they appear in, and end at the first dynamic index.
+	Paths []string
+	// Variables lists the variables referenced in the query that are not bound within the
+	// query, such as "$foo", sorted and deduplicated. Built-in variables like $ENV are
+	// omitted.
+	Variables []string
+}
+
+// Err returns the first diagnostic as an error, or nil if the query is valid.
+func (v Validation) Err() error {
+	if len(v.Diagnostics) == 0 {
+		return nil
+	}
+	return v.Diagnostics[0]
+}
+
+// Diagnostic describes a problem with a query.
+type Diagnostic struct {
+	// Message describes the problem.
+	Message string
+	// Offset is the byte offset in the query where the problem was found, or -1 if the
+	// location is not known.
+	Offset int
+	// Line and Column are the 1-based position of Offset in the query, where Column
+	// counts characters. Both are 0 if the location is not known.
+	Line, Column int
+	// Suggestion is an optional hint on how to fix the problem.
+	Suggestion string
+}
+
+var _ error = Diagnostic{}
+
+func (d Diagnostic) Error() string {
+	var msg strings.Builder
+	if d.Line > 0 {
+		fmt.Fprintf(&msg, "%d:%d: ", d.Line, d.Column)
+	}
+	msg.WriteString(d.Message)
+	if d.Suggestion != "" {
+		fmt.Fprintf(&msg, " (%s)", d.Suggestion)
+	}
+	return msg.String()
+}
+
+// Validate parses and compiles a query without running it, returning diagnostics for
+// any problems found along with the paths and variables referenced by the query. This is
+// useful for checking user-provided queries before they are used, or for building query
+// autocompletion.
+//
+// Options that affect compilation, such as WithVariable and WithFunction, are taken into
+// account.
+func Validate(query string, opts ...Option) Validation {
+	o := buildOptions(opts)
+
+	parsed, err := gojq.Parse(query)
+	if err != nil {
+		return Validation{Diagnostics: []Diagnostic{parseDiagnostic(query, err)}}
+	}
+
+	r := newReferences()
+	r.query(parsed, nil)
+	v := Validation{
+		Paths:     sortedKeys(r.paths),
+		Variables: sortedKeys(r.variables),
+	}
+
+	names, _ := o.variables()
+	if _, err := gojq.Compile(parsed, o.compilerOptions(names)...); err != nil {
+		v.Diagnostics = []Diagnostic{compileDiagnostic(query, err, o, names)}
+	}
+	return v
+}
+
+// parseDiagnostic creates a diagnostic for an error from gojq.Parse.
+func parseDiagnostic(query string, err error) Diagnostic {
+	d := Diagnostic{Message: err.Error(), Offset: -1}
+
+	var tokenErr interface{ Token() (string, int) }
+	if !errors.As(err, &tokenErr) {
+		return d
+	}
+	// The offset reported by gojq is the end of the token.
+	token, offset := tokenErr.Token()
+	d.setOffset(query, offset-len(token))
+
+	switch {
+	case token == "'":
+		d.Suggestion = "strings must use double quotes"
+	case strings.HasPrefix(d.Message, "unexpected EOF"):
+		d.Suggestion = "check for unclosed brackets, parentheses, or strings"
+	case strings.HasPrefix(d.Message, "unterminated string"):
+		d.Suggestion = `add a closing '"'`
+	case strings.HasPrefix(d.Message, "invalid escape sequence"):
+		d.Suggestion = `use "\\\\" for a literal backslash`
+	case token == "}" || token == "]" || token == ")":
+		d.Suggestion = "check for a missing value or an unmatched " + token
+	}
+	return d
+}
+
+var (
+	variableNotDefined = regexp.MustCompile(`^variable not defined: (\$\w+)$`)
+	functionNotDefined = regexp.MustCompile(`^function not defined: (\w+)/(\d+)$`)
+)
+
+// compileDiagnostic creates a diagnostic for an error from gojq.Compile. The location of
+// the problem is guessed from the error, since gojq does not provide it.
+func compileDiagnostic(query string, err error, o *options, variableNames []string) Diagnostic {
+	d := Diagnostic{Message: err.Error(), Offset: -1}
+
+	if m := variableNotDefined.FindStringSubmatch(d.Message); m != nil {
+		d.setOffset(query, findIdent(query, m[1]))
+		if match := closestName(m[1], variableNames); match != "" {
+			d.Suggestion = fmt.Sprintf("did you mean %s?", match)
+		} else {
+			d.Suggestion = "provide it with WithVariable"
+		}
+	} else if m := functionNotDefined.FindStringSubmatch(d.Message); m != nil {
+		d.setOffset(query, findIdent(query, m[1]))
+		candidates := builtinNames()
+		for _, f := range o.functions {
+			candidates = append(candidates, f.name)
+		}
+		if match := closestName(m[1], candidates); match != "" {
+			d.Suggestion = fmt.Sprintf("did you mean %s?", match)
+		}
+	}
+	return d
+}
+
+// setOffset sets the location of the diagnostic to offset in query.
+func (d *Diagnostic) setOffset(query string, offset int) {
+	if offset < 0 || offset > len(query) {
+		return
+	}
+	d.Offset = offset
+	before := query[:offset]
+	d.Line = strings.Count(before, "\n") + 1
+	d.Column = utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+}
+
+// findIdent returns the offset of the first use of the identifier or variable name in
+// query, or -1 if it is not found.
+func findIdent(query, name string) int {
+	loc := regexp.MustCompile(`(^|[^\w$.])` + regexp.QuoteMeta(name) + `\b`).FindStringSubmatchIndex(query)
+	if loc == nil {
+		return -1
+	}
+	return loc[3]
+}
+
+// closestName returns the candidate closest to name, or an empty string if no candidate
+// is close enough to be a likely typo.
+func closestName(name string, candidates []string) string {
+	var closest string
+	best := len(name)/3 + 1
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		if d := editDistance(name, c); d <= best && (closest == "" || d < best) {
+			closest, best = c, d
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+var (
+	builtinNamesOnce sync.Once
+	builtinNamesList []string
+)
+
+// builtinNames returns the names of gojq's built-in functions.
+func builtinNames() []string {
+	builtinNamesOnce.Do(func() {
+		q, err := gojq.Parse(`builtins | map(split("/")[0]) | unique`)
+		if err != nil {
+			return
+		}
+		code, err := gojq.Compile(q)
+		if err != nil {
+			return
+		}
+		v, _ := code.Run(nil).Next()
+		names, _ := v.([]interface{})
+		for _, n := range names {
+			builtinNamesList = append(builtinNamesList, n.(string))
+		}
+	})
+	return builtinNamesList
+}
+
+// builtinVariables are variables that are always defined.
+var builtinVariables = map[string]bool{"$ENV": true, "$__loc__": true, "$ARGS": true}
+
+// references collects the paths and variables referenced in a query.
+type references struct {
+	paths     map[string]struct{}
+	variables map[string]struct{}
+}
+
+func newReferences() *references {
+	return &references{
+		paths:     make(map[string]struct{}),
+		variables: make(map[string]struct{}),
+	}
+}
+
+// query collects references in q, where bound is the list of variables bound in the
+// enclosing scope.
+func (r *references) query(q *gojq.Query, bound []string) {
+	if q == nil {
+		return
+	}
+	for _, fd := range q.FuncDefs {
+		r.query(fd.Body, bind(bound, fd.Args...))
+	}
+	r.term(q.Term, bound)
+	r.query(q.Left, bound)
+	r.query(q.Right, bound)
+}
+
+func (r *references) term(t *gojq.Term, bound []string) {
+	if t == nil {
+		return
+	}
+	if path := termPath(t); path != "" {
+		r.paths[path] = struct{}{}
+	}
+
+	switch t.Type {
+	case gojq.TermTypeIndex:
+		r.index(t.Index, bound)
+	case gojq.TermTypeFunc:
+		r.variable(t.Func.Name, bound)
+		for _, arg := range t.Func.Args {
+			r.query(arg, bound)
+		}
+	case gojq.TermTypeObject:
+		for _, kv := range t.Object.KeyVals {
+			r.variable(kv.Key, bound)
+			r.str(kv.KeyString, bound)
+			r.query(kv.KeyQuery, bound)
+			if kv.Val != nil {
+				for _, v := range kv.Val.Queries {
+					r.query(v, bound)
+				}
+			}
+		}
+	case gojq.TermTypeArray:
+		r.query(t.Array.Query, bound)
+	case gojq.TermTypeUnary:
+		r.term(t.Unary.Term, bound)
+	case gojq.TermTypeFormat, gojq.TermTypeString:
+		r.str(t.Str, bound)
+	case gojq.TermTypeIf:
+		r.query(t.If.Cond, bound)
+		r.query(t.If.Then, bound)
+		for _, elif := range t.If.Elif {
+			r.query(elif.Cond, bound)
+			r.query(elif.Then, bound)
+		}
+		r.query(t.If.Else, bound)
+	case gojq.TermTypeTry:
+		r.query(t.Try.Body, bound)
+		r.query(t.Try.Catch, bound)
+	case gojq.TermTypeReduce:
+		r.term(t.Reduce.Term, bound)
+		inner := r.pattern(t.Reduce.Pattern, bound, bound)
+		r.query(t.Reduce.Start, bound)
+		r.query(t.Reduce.Update, inner)
+	case gojq.TermTypeForeach:
+		r.term(t.Foreach.Term, bound)
+		inner := r.pattern(t.Foreach.Pattern, bound, bound)
+		r.query(t.Foreach.Start, bound)
+		r.query(t.Foreach.Update, inner)
+		r.query(t.Foreach.Extract, inner)
+	case gojq.TermTypeLabel:
+		r.query(t.Label.Body, bound)
+	case gojq.TermTypeQuery:
+		r.query(t.Query, bound)
+	}
+
+	for _, s := range t.SuffixList {
+		if s.Index != nil {
+			r.index(s.Index, bound)
+		}
+		if s.Bind != nil {
+			inner := bound
+			for _, p := range s.Bind.Patterns {
+				inner = r.pattern(p, bound, inner)
+			}
+			r.query(s.Bind.Body, inner)
+		}
+	}
+}
+
+func (r *references) index(i *gojq.Index, bound []string) {
+	r.str(i.Str, bound)
+	r.query(i.Start, bound)
+	r.query(i.End, bound)
+}
+
+func (r *references) str(s *gojq.String, bound []string) {
+	if s == nil {
+		return
+	}
+	for _, q := range s.Queries {
+		r.query(q, bound)
+	}
+}
+
+// pattern collects references in p, which are resolved in bound, and returns inner with
+// the variables bound by p added.
+func (r *references) pattern(p *gojq.Pattern, bound, inner []string) []string {
+	if p == nil {
+		return inner
+	}
+	if p.Name != "" {
+		inner = bind(inner, p.Name)
+	}
+	for _, e := range p.Array {
+		inner = r.pattern(e, bound, inner)
+	}
+	for _, o := range p.Object {
+		if strings.HasPrefix(o.Key, "$") {
+			inner = bind(inner, o.Key)
+		}
+		r.str(o.KeyString, bound)
+		r.query(o.KeyQuery, bound)
+		inner = r.pattern(o.Val, bound, inner)
+	}
+	return inner
+}
+
+// variable records name if it is a variable that is not bound.
+func (r *references) variable(name string, bound []string) {
+	if !strings.HasPrefix(name, "$") || builtinVariables[name] {
+		return
+	}
+	for _, b := range bound {
+		if b == name {
+			return
+		}
+	}
+	r.variables[name] = struct{}{}
+}
+
+// bind returns a copy of bound with the variables in names added. Function parameters
+// that are not variables are ignored.
+func bind(bound []string, names ...string) []string {
+	inner := bound[:len(bound):len(bound)]
+	for _, n := range names {
+		if strings.HasPrefix(n, "$") {
+			inner = append(inner, n)
+		}
+	}
+	return inner
+}
+
+// termPath returns the path that t indexes into, or an empty string if t is not a path.
+func termPath(t *gojq.Term) string {
+	var path strings.Builder
+	switch t.Type {
+	case gojq.TermTypeIndex:
+		segment, ok := indexSegment(t.Index)
+		if !ok {
+			return ""
+		}
+		path.WriteString(segment)
+	case gojq.TermTypeIdentity:
+	default:
+		return ""
+	}
+
+	for _, s := range t.SuffixList {
+		var segment string
+		switch {
+		case s.Optional:
+			continue
+		case s.Iter:
+			segment = "[]"
+		case s.Index != nil:
+			var ok bool
+			if segment, ok = indexSegment(s.Index); !ok {
+				return pathString(&path)
+			}
+		default:
+			return pathString(&path)
+		}
+		path.WriteString(segment)
+	}
+	return pathString(&path)
+}
+
+// pathString returns the path, prefixed with '.' if needed.
+func pathString(path *strings.Builder) string {
+	s := path.String()
+	if strings.HasPrefix(s, "[") {
+		return "." + s
+	}
+	return s
+}
+
+// indexSegment returns the path segment for a constant index.
+func indexSegment(i *gojq.Index) (string, bool) {
+	switch {
+	case i.Name != "":
+		return "." + i.Name, true
+	case i.Str != nil:
+		return stringSegment(i.Str)
+	case i.IsSlice || i.Start == nil || i.Start.Left != nil || i.Start.Term == nil ||
+		i.Start.Term.SuffixList != nil:
+		return "", false
+	case i.Start.Term.Type == gojq.TermTypeNumber:
+		return "[" + i.Start.Term.Number + "]", true
+	case i.Start.Term.Type == gojq.TermTypeString:
+		return stringSegment(i.Start.Term.Str)
+	default:
+		return "", false
+	}
+}
+
+// stringSegment returns the path segment for a constant string key.
+func stringSegment(s *gojq.String) (string, bool) {
+	if s.Queries != nil {
+		return "", false
+	}
+	key, _ := json.Marshal(s.Str)
+	return "[" + string(key) + "]", true
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,127 @@
+package jq
+
+import (
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		query string
+		opts  []Option
+		want  autogold.Value
+	}{
+		{
+			name:  "valid",
+			query: `.a.b[0].c, .["x y"][] | .d[.e] | .[]?.f | "\(.g)"`,
+			want: autogold.Expect(Validation{Paths: []string{
+				`.["x y"][]`, ".[].f", ".a.b[0].c", ".d",
+				".e",
+				".g",
+			}}),
+		},
+		{
+			name:  "variables",
+			query: `.items[] as {id: $id} | reduce .[] as [$v] (0; . + $v + $id) | def f($p): $p + $q; f($ENV) | {$r, s: $s}`,
+			opts:  []Option{WithVariable("q", 1), WithVariable("r", 2), WithVariable("s", 3)},
+			want: autogold.Expect(Validation{
+				Paths:     []string{".[]", ".items[]"},
+				Variables: []string{"$q", "$r", "$s"},
+			}),
+		},
+		{
+			name:  "parse error",
+			query: ".foo\n| .bar )",
+			want: autogold.Expect(Validation{Diagnostics: []Diagnostic{{
+				Message:    `unexpected token ")"`,
+				Offset:     12,
+				Line:       2,
+				Column:     8,
+				Suggestion: "check for a missing value or an unmatched )",
+			}}}),
+		},
+		{
+			name:  "unexpected EOF",
+			query: ".a | map(.b",
+			want: autogold.Expect(Validation{Diagnostics: []Diagnostic{{
+				Message:    "unexpected EOF",
+				Offset:     11,
+				Line:       1,
+				Column:     12,
+				Suggestion: "check for unclosed brackets, parentheses, or strings",
+			}}}),
+		},
+		{
+			name:  "single quotes",
+			query: ".a == 'b'",
+			want: autogold.Expect(Validation{Diagnostics: []Diagnostic{{
+				Message:    `unexpected token "'"`,
+				Offset:     6,
+				Line:       1,
+				Column:     7,
+				Suggestion: "strings must use double quotes",
+			}}}),
+		},
+		{
+			name:  "unknown function",
+			query: ".a | lenght",
+			want: autogold.Expect(Validation{
+				Diagnostics: []Diagnostic{{
+					Message:    "function not defined: lenght/0",
+					Offset:     5,
+					Line:       1,
+					Column:     6,
+					Suggestion: "did you mean length?",
+				}},
+				Paths: []string{".a"},
+			}),
+		},
+		{
+			name:  "unknown variable",
+			query: "{a: .a, b: $nmae}",
+			opts:  []Option{WithVariable("name", "foo")},
+			want: autogold.Expect(Validation{
+				Diagnostics: []Diagnostic{{
+					Message:    "variable not defined: $nmae",
+					Offset:     11,
+					Line:       1,
+					Column:     12,
+					Suggestion: "did you mean $name?",
+				}},
+				Paths:     []string{".a"},
+				Variables: []string{"$nmae"},
+			}),
+		},
+		{
+			name:  "undefined variable",
+			query: "$foo",
+			want: autogold.Expect(Validation{
+				Diagnostics: []Diagnostic{{
+					Message:    "variable not defined: $foo",
+					Line:       1,
+					Column:     1,
+					Suggestion: "provide it with WithVariable",
+				}},
+				Variables: []string{"$foo"},
+			}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			tc.want.Equal(t, Validate(tc.query, tc.opts...))
+		})
+	}
+
+	t.Run("Err", func(t *testing.T) {
+		t.Parallel()
+
+		assert.NoError(t, Validate(".foo").Err())
+		autogold.Expect(`1:6: function not defined: lenght/0 (did you mean length?)`).
+			Equal(t, Validate(".a | lenght").Err().Error())
+	})
+}
@@ -1,27 +1,115 @@
 package pipe
 
-import "github.com/djherbis/buffer"
+import (
+	"io"
+
+	"github.com/djherbis/buffer"
+)
 
 // MemoryBufferSize confiugres the maximum in-memory size of the buffers created by this
 // package.
 //
 // When using the default unbounded buffer in NewStream, overflows are written to disk at
 // increments of size FileBuffersSize.
+//
+// MemoryBufferSize applies to all streams created without explicit options - to
+// configure buffers for a single stream, use NewStreamWithOptions instead.
 var MemoryBufferSize int64 = 32 * 1024 * 1024 // 32MB
 
 // FileBuffersSize confiugres the size of files created to store buffer overflows after
 // the in-memory capacity, MemoryBufferSize, is reached in the unbounded buffers created
 // by NewStream.
+//
+// FileBuffersSize applies to all streams created without explicit options - to
+// configure buffers for a single stream, use NewStreamWithOptions instead.
 var FileBuffersSize int64 = 124 * 1024 * 1024 // 124MB
 
+// Options configures the buffer of a stream created with NewStreamWithOptions. Zero
+// values fall back to the package defaults.
+type Options struct {
+	// MemoryLimit is the maximum in-memory size of the buffer. If zero, MemoryBufferSize
+	// is used.
+	MemoryLimit int64
+	// FileChunkSize is the size of each file created to store overflows after the
+	// in-memory capacity is reached. If zero, FileBuffersSize is used.
+	FileChunkSize int64
+	// TempDir is the directory files are created in to store overflows. If empty, the
+	// default directory for temporary files is used.
+	TempDir string
+	// MaxDiskBytes is the maximum number of unread bytes to store in files after the
+	// in-memory capacity is reached. Once the limit is reached, writes block until data
+	// is read. If zero, the amount of data stored in files is unbounded. If negative, data
+	// is never stored in files, as with NewBoundedStream.
+	MaxDiskBytes int64
+
+	// Monitor, if set, collects live statistics about the buffer - see Monitor.
+	Monitor *Monitor
+}
+
+func (o Options) withDefaults() Options {
+	if o.MemoryLimit <= 0 {
+		o.MemoryLimit = MemoryBufferSize
+	}
+	if o.FileChunkSize <= 0 {
+		o.FileChunkSize = FileBuffersSize
+	}
+	return o
+}
+
+// makeBuffer creates a buffer based on the options. Unless disabled, the buffer creates
+// files of size FileChunkSize after the in-memory capacity fills up to store overflow.
+func (o Options) makeBuffer() buffer.Buffer {
+	o = o.withDefaults()
+	memory := buffer.New(o.MemoryLimit)
+
+	var files buffer.Buffer
+	var pool *countingPool
+	if o.MaxDiskBytes >= 0 {
+		pool = &countingPool{Pool: buffer.NewFilePool(o.FileChunkSize, o.TempDir)}
+		files = buffer.NewPartition(pool)
+		if o.MaxDiskBytes > 0 {
+			files = &limitedBuffer{Buffer: files, limit: o.MaxDiskBytes}
+		}
+	}
+
+	var b buffer.Buffer = memory
+	if files != nil {
+		b = buffer.NewMulti(memory, files)
+	}
+	if o.Monitor != nil {
+		o.Monitor.start()
+		b = &monitoredBuffer{Buffer: b, monitor: o.Monitor, memory: memory, files: files, pool: pool}
+	}
+	return b
+}
+
 // makeUnboundedBuffer creates a buffer that create files of size fileBuffersSize after
 // the in-memory capacity fills up to store overflow.
 func makeUnboundedBuffer() buffer.Buffer {
-	return buffer.NewUnboundedBuffer(MemoryBufferSize, FileBuffersSize)
+	return Options{}.makeBuffer()
 }
 
 // makeMemoryBuffer creates a buffer that only works up to MemoryBufferSize, and never
 // overflows to disk unlike the unbounded buffer.
 func makeMemoryBuffer() buffer.Buffer {
-	return buffer.New(MemoryBufferSize)
+	return Options{MaxDiskBytes: -1}.makeBuffer()
+}
+
+// limitedBuffer caps the capacity of an unbounded buffer.
+type limitedBuffer struct {
+	buffer.Buffer
+	limit int64
+}
+
+func (b *limitedBuffer) Cap() int64 { return b.limit }
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if gap := buffer.Gap(b); gap < int64(len(p)) {
+		n, err := b.Buffer.Write(p[:gap])
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		return n, err
+	}
+	return b.Buffer.Write(p)
 }
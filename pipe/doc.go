@@ -1,4 +1,4 @@
-// Package pipe provides implementations of unbounded and in-memory pipes, which provides
-// a writer that the caller can use to collect data and a streamline.Stream instance that
-// can be used to consume the data.
+// Package pipe provides implementations of unbounded, in-memory, lossy, and durable
+// pipes, which provides a writer that the caller can use to collect data and a
+// streamline.Stream instance that can be used to consume the data.
 package pipe
@@ -0,0 +1,571 @@
+package pipe
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bobheadxi.dev/streamline"
+)
+
+// SyncPolicy configures when data written to a durable stream is flushed to disk with
+// fsync.
+type SyncPolicy int
+
+const (
+	// SyncNone never explicitly flushes data to disk, relying on the operating system. It
+	// is the default policy. Data survives process restarts, but not system crashes.
+	SyncNone SyncPolicy = iota
+	// SyncAlways flushes data to disk after every write and commit of the reader
+	// position.
+	SyncAlways
+	// SyncInterval flushes data to disk on writes and commits if
+	// DurableOptions.SyncInterval has elapsed since the last flush, and when the writer is
+	// closed.
+	SyncInterval
+)
+
+// DurableOptions configures NewDurableStream.
+type DurableOptions struct {
+	// Dir is the directory to store data in. It is created if it does not exist. It is
+	// required.
+	Dir string
+	// SegmentSize is the size at which a new segment file is started. The default is
+	// 64MB.
+	SegmentSize int64
+
+	// Sync configures when data is flushed to disk.
+	Sync SyncPolicy
+	// SyncInterval is the interval for the SyncInterval policy. The default is 1 second.
+	SyncInterval time.Duration
+
+	// RetentionBytes, if set, is the maximum size of unread data to retain. When the
+	// limit is exceeded, the oldest segments are removed even if they have not been
+	// read. Retention is applied when data is written.
+	RetentionBytes int64
+	// RetentionAge, if set, is the maximum age of unread data to retain. Segments that
+	// were last written to longer than RetentionAge ago are removed even if they have not
+	// been read.
+	RetentionAge time.Duration
+}
+
+const (
+	durableSegmentSuffix = ".segment"
+	durableOffsetFile    = "offset"
+	durableLockFile      = "lock"
+)
+
+// errDurableDirInUse indicates that a durable stream directory is locked by another
+// durable stream.
+var errDurableDirInUse = errors.New("directory is in use by another durable stream")
+
+// NewDurableStream creates a Stream that consumes and emits data written to the returned
+// writer, piped through an append-only log of segment files in DurableOptions.Dir. The
+// position of the reader in the log is persisted, such that if the process restarts,
+// data that has been written but not read is emitted by a Stream created with the same
+// Dir. Segments are removed once they have been read, and unread data is retained
+// according to DurableOptions.RetentionBytes and DurableOptions.RetentionAge.
+//
+// The position of the reader is committed at line boundaries once each line has been
+// emitted, when the Stream reads the next line - lines that were read but not yet fully
+// handled, for example because the process crashed, are emitted again by the next durable
+// stream.
+//
+// Only one durable stream may use a directory at a time, and NewDurableStream returns an
+// error if the directory is in use. The directory is released once the Stream has been
+// read to completion, or when the Stream is closed with (*Stream).Close().
+//
+// The returned WriterErrorCloser must be closed by the caller when all data has been
+// written or when an error occurs at the source to indicate to the stream that no further
+// data will become available. Closing the writer does not prevent future durable streams
+// from appending to the log.
+func NewDurableStream(opts DurableOptions) (writer WriterErrorCloser, stream *streamline.Stream, err error) {
+	if opts.Dir == "" {
+		return nil, nil, errors.New("pipe: durable stream directory is required")
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 * 1024 * 1024
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	l, err := openDurableLog(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pipe: %w", err)
+	}
+	return &durableWriter{l}, streamline.New(newDurableReader(l)), nil
+}
+
+// durableLog is an append-only log of segment files with a single reader.
+type durableLog struct {
+	opts DurableOptions
+
+	mux  sync.Mutex
+	cond *sync.Cond
+
+	// segments are the segments in the log, ordered by offset. The last segment is the
+	// active segment that is written to.
+	segments []*durableSegment
+	// active is the open file of the active segment.
+	active *os.File
+	// end is the offset of the end of the log.
+	end int64
+
+	// offset is the committed offset of the reader, which is persisted in offsetFile.
+	offset     int64
+	offsetFile *os.File
+	// readOffset is the offset of the data read from the log, which may be ahead of the
+	// committed offset.
+	readOffset int64
+	// reading is the open file of the segment being read, if any.
+	reading        *os.File
+	readingSegment *durableSegment
+
+	// lockFile holds the lock on the directory.
+	lockFile *os.File
+
+	lastSync time.Time
+
+	closed bool
+	err    error
+	// released is set once the files of the log have been closed and the directory has
+	// been unlocked, after which reads return readErr.
+	released bool
+	readErr  error
+}
+
+type durableSegment struct {
+	base    int64
+	size    int64
+	modTime time.Time
+}
+
+func (s *durableSegment) path(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", s.base, durableSegmentSuffix))
+}
+
+func openDurableLog(opts DurableOptions) (_ *durableLog, err error) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &durableLog{opts: opts, lastSync: time.Now()}
+	l.cond = sync.NewCond(&l.mux)
+	if l.lockFile, err = lockDurableDir(opts.Dir); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			l.close()
+		}
+	}()
+
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, durableSegmentSuffix) {
+			continue
+		}
+		base, err := strconv.ParseInt(strings.TrimSuffix(name, durableSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		l.segments = append(l.segments, &durableSegment{base: base, size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].base < l.segments[j].base })
+
+	// Restore the reader offset.
+	l.offsetFile, err = os.OpenFile(filepath.Join(opts.Dir, durableOffsetFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(l.offsetFile)
+	if err != nil {
+		return nil, err
+	}
+	if s := strings.TrimSpace(string(data)); s != "" {
+		if l.offset, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid offset: %w", err)
+		}
+	}
+
+	if len(l.segments) == 0 {
+		l.segments = []*durableSegment{{base: l.offset, modTime: time.Now()}}
+	}
+	last := l.segments[len(l.segments)-1]
+	l.end = last.base + last.size
+	l.active, err = os.OpenFile(last.path(opts.Dir), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	// The offset may be out of range if segments were removed or the log was truncated.
+	if first := l.segments[0].base; l.offset < first {
+		l.offset = first
+	} else if l.offset > l.end {
+		l.offset = l.end
+	}
+	l.readOffset = l.offset
+	if err := l.removeReadSegments(); err != nil {
+		return nil, err
+	}
+	if err := l.writeOffset(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *durableLog) write(p []byte) (int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed || l.released {
+		return 0, io.ErrClosedPipe
+	}
+
+	active := l.segments[len(l.segments)-1]
+	if active.size >= l.opts.SegmentSize {
+		if err := l.roll(); err != nil {
+			return 0, err
+		}
+		active = l.segments[len(l.segments)-1]
+	}
+
+	n, err := l.active.Write(p)
+	active.size += int64(n)
+	active.modTime = time.Now()
+	l.end += int64(n)
+	if n > 0 {
+		l.cond.Broadcast()
+	}
+	if err != nil {
+		return n, err
+	}
+	if err := l.maybeSync(l.active); err != nil {
+		return n, err
+	}
+	return n, l.applyRetention()
+}
+
+// roll starts a new active segment. It must be called while holding l.mux.
+func (l *durableLog) roll() error {
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+	next := &durableSegment{base: l.end, modTime: time.Now()}
+	f, err := os.OpenFile(next.path(l.opts.Dir), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.active = f
+	l.segments = append(l.segments, next)
+	return nil
+}
+
+// applyRetention removes the oldest inactive segments that exceed the retention
+// configuration. It must be called while holding l.mux.
+func (l *durableLog) applyRetention() error {
+	if l.opts.RetentionBytes <= 0 && l.opts.RetentionAge <= 0 {
+		return nil
+	}
+	for len(l.segments) > 1 {
+		oldest := l.segments[0]
+		unread := l.end - l.offset
+		tooLarge := l.opts.RetentionBytes > 0 && unread > l.opts.RetentionBytes
+		tooOld := l.opts.RetentionAge > 0 && time.Since(oldest.modTime) > l.opts.RetentionAge
+		if !tooLarge && !tooOld {
+			return nil
+		}
+		if err := l.removeOldest(); err != nil {
+			return err
+		}
+		// Skip the reader past the removed data.
+		next := l.segments[0].base
+		if l.readOffset < next {
+			l.readOffset = next
+		}
+		if l.offset < next {
+			l.offset = next
+			if err := l.writeOffset(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeOldest removes the oldest segment. It must be called while holding l.mux.
+func (l *durableLog) removeOldest() error {
+	oldest := l.segments[0]
+	if l.readingSegment == oldest {
+		l.reading.Close()
+		l.reading, l.readingSegment = nil, nil
+	}
+	if err := os.Remove(oldest.path(l.opts.Dir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	l.segments[0] = nil
+	l.segments = l.segments[1:]
+	return nil
+}
+
+// removeReadSegments removes inactive segments that have been fully committed. It must be
+// called while holding l.mux.
+func (l *durableLog) removeReadSegments() error {
+	for len(l.segments) > 1 && l.segments[1].base <= l.offset {
+		if err := l.removeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads data from the log at readOffset, blocking until data is available. It does
+// not commit the offset - see commit.
+func (l *durableLog) read(p []byte) (int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for l.readOffset >= l.end || l.released {
+		if l.released {
+			return 0, l.readErr
+		}
+		if l.closed {
+			readErr := l.err
+			if readErr == nil {
+				readErr = io.EOF
+			}
+			l.release(readErr)
+			return 0, readErr
+		}
+		l.cond.Wait()
+	}
+
+	segment := l.segmentAt(l.readOffset)
+	if l.readingSegment != segment {
+		if l.reading != nil {
+			l.reading.Close()
+		}
+		f, err := os.Open(segment.path(l.opts.Dir))
+		if err != nil {
+			return 0, err
+		}
+		l.reading, l.readingSegment = f, segment
+	}
+
+	pos := l.readOffset - segment.base
+	if remaining := segment.size - pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.reading.ReadAt(p, pos)
+	if err == io.EOF && n == len(p) {
+		err = nil
+	}
+	l.readOffset += int64(n)
+	return n, err
+}
+
+// segmentAt returns the segment containing offset. It must be called while holding
+// l.mux.
+func (l *durableLog) segmentAt(offset int64) *durableSegment {
+	for i := len(l.segments) - 1; i > 0; i-- {
+		if l.segments[i].base <= offset {
+			return l.segments[i]
+		}
+	}
+	return l.segments[0]
+}
+
+// position returns the offset of the data read from the log.
+func (l *durableLog) position() int64 {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.readOffset
+}
+
+// commit persists offset as the position of the reader, and removes segments that have
+// been fully committed.
+func (l *durableLog) commit(offset int64) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	// The offset may be behind if data has been removed by retention.
+	if l.released || offset <= l.offset {
+		return nil
+	}
+	l.offset = offset
+	if err := l.writeOffset(); err != nil {
+		return err
+	}
+	return l.removeReadSegments()
+}
+
+// writeOffset persists the reader offset. It must be called while holding l.mux.
+func (l *durableLog) writeOffset() error {
+	// Offsets are written with a fixed width, so the file can be overwritten in place.
+	if _, err := l.offsetFile.WriteAt([]byte(fmt.Sprintf("%020d\n", l.offset)), 0); err != nil {
+		return err
+	}
+	return l.maybeSync(l.offsetFile)
+}
+
+// maybeSync flushes f to disk according to the sync policy. It must be called while
+// holding l.mux.
+func (l *durableLog) maybeSync(f *os.File) error {
+	switch l.opts.Sync {
+	case SyncAlways:
+		return f.Sync()
+	case SyncInterval:
+		if time.Since(l.lastSync) < l.opts.SyncInterval {
+			return nil
+		}
+		if err := l.sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sync flushes all open files to disk. It must be called while holding l.mux.
+func (l *durableLog) sync() error {
+	l.lastSync = time.Now()
+	if l.active != nil {
+		if err := l.active.Sync(); err != nil {
+			return err
+		}
+	}
+	if l.offsetFile != nil {
+		return l.offsetFile.Sync()
+	}
+	return nil
+}
+
+func (l *durableLog) closeWithError(err error) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	l.err = err
+	l.cond.Broadcast()
+
+	var syncErr error
+	if l.opts.Sync != SyncNone {
+		syncErr = l.sync()
+	}
+	if l.active != nil {
+		l.active.Close()
+		l.active = nil
+	}
+	return syncErr
+}
+
+// release closes all files and unlocks the directory, after which reads return readErr.
+// It must be called while holding l.mux.
+func (l *durableLog) release(readErr error) {
+	if l.released {
+		return
+	}
+	l.close()
+	l.released = true
+	l.readErr = readErr
+	l.cond.Broadcast()
+}
+
+// close closes all files and unlocks the directory. It must be called while holding
+// l.mux.
+func (l *durableLog) close() {
+	if l.active != nil {
+		l.active.Close()
+		l.active = nil
+	}
+	if l.reading != nil {
+		l.reading.Close()
+		l.reading, l.readingSegment = nil, nil
+	}
+	if l.offsetFile != nil {
+		if l.opts.Sync != SyncNone {
+			_ = l.offsetFile.Sync()
+		}
+		l.offsetFile.Close()
+		l.offsetFile = nil
+	}
+	if l.lockFile != nil {
+		_ = unlockDurableDir(l.lockFile)
+		l.lockFile = nil
+	}
+}
+
+type durableWriter struct{ l *durableLog }
+
+func (w *durableWriter) Write(p []byte) (int, error)    { return w.l.write(p) }
+func (w *durableWriter) CloseWithError(err error) error { return w.l.closeWithError(err) }
+
+// durableReader reads lines from a durableLog. It implements streamline.LineReader, so
+// that offsets are committed at the boundaries of the lines emitted by the Stream.
+type durableReader struct {
+	l      *durableLog
+	reader *bufio.Reader
+
+	// pending is the offset of the end of the last line read, to be committed when the
+	// next line is read.
+	pending    int64
+	hasPending bool
+}
+
+var _ streamline.LineReader = (*durableReader)(nil)
+
+func newDurableReader(l *durableLog) *durableReader {
+	return &durableReader{
+		l:      l,
+		reader: bufio.NewReader(readerFunc(l.read)),
+	}
+}
+
+// ReadSlice commits the end of the last line read, since the Stream only reads the next
+// line once the previous line has been handled, and reads the next line.
+func (r *durableReader) ReadSlice(delim byte) ([]byte, error) {
+	if r.hasPending {
+		if err := r.l.commit(r.pending); err != nil {
+			return nil, err
+		}
+		r.hasPending = false
+	}
+	data, err := r.reader.ReadSlice(delim)
+	if len(data) > 0 && err != bufio.ErrBufferFull {
+		r.pending = r.l.position() - int64(r.reader.Buffered())
+		r.hasPending = true
+	}
+	return data, err
+}
+
+// Read implements io.Reader. It is not used by Stream, which reads with ReadSlice, and
+// does not commit offsets.
+func (r *durableReader) Read(p []byte) (int, error) { return r.reader.Read(p) }
+
+// Close releases the log without committing the last line read, and causes further
+// writes to error.
+func (r *durableReader) Close() error {
+	r.l.mux.Lock()
+	defer r.l.mux.Unlock()
+	r.l.release(io.ErrClosedPipe)
+	return nil
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
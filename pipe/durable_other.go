@@ -0,0 +1,28 @@
+//go:build !unix || aix || solaris
+
+package pipe
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// lockDurableDir locks dir by exclusively creating a lock file. If the process exits
+// without unlocking the directory, the lock file must be removed manually.
+func lockDurableDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, durableLockFile), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, errDurableDirInUse
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockDurableDir releases a lock acquired with lockDurableDir.
+func unlockDurableDir(f *os.File) error {
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,163 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurableStream(t *testing.T) {
+	t.Run("no directory", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, err := NewDurableStream(DurableOptions{})
+		require.Error(t, err)
+	})
+
+	t.Run("read and write", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		w, s, err := NewDurableStream(DurableOptions{Dir: dir, SegmentSize: 64, Sync: SyncAlways})
+		require.NoError(t, err)
+
+		go func() {
+			for i := 0; i < 100; i++ {
+				fmt.Fprintf(w, "line %d\n", i)
+			}
+			w.CloseWithError(nil)
+		}()
+
+		lines, err := s.Lines()
+		require.NoError(t, err)
+		assert.Len(t, lines, 100)
+		assert.Equal(t, "line 99", lines[99])
+
+		// Read segments are removed
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 3) // lock, offset, and active segment
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		opts := DurableOptions{Dir: dir, SegmentSize: 8, Sync: SyncInterval}
+
+		// Write without reading
+		w, s, err := NewDurableStream(opts)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("foo\nbar\nbaz\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.CloseWithError(nil))
+		require.NoError(t, s.Close())
+
+		// Unread data is emitted after a restart
+		w, s, err = NewDurableStream(opts)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("hello\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.CloseWithError(nil))
+		lines, err := s.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"foo", "bar", "baz", "hello"}).Equal(t, lines)
+
+		// Read data is not emitted again
+		w, s, err = NewDurableStream(opts)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("world\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.CloseWithError(nil))
+		lines, err = s.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"world"}).Equal(t, lines)
+	})
+
+	t.Run("lines are committed once handled", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		opts := DurableOptions{Dir: dir, SegmentSize: 8}
+		w, s, err := NewDurableStream(opts)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("foo\nbar\nbaz\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.CloseWithError(nil))
+
+		// Stop while handling the second line, as if the process crashed.
+		errStop := errors.New("stop")
+		var handled []string
+		err = s.StreamBytes(func(line []byte) error {
+			if len(handled) == 1 {
+				return errStop
+			}
+			handled = append(handled, string(line))
+			return nil
+		})
+		require.ErrorIs(t, err, errStop)
+		require.NoError(t, s.Close())
+		autogold.Expect([]string{"foo"}).Equal(t, handled)
+
+		// The line that was not handled is emitted again.
+		w, s, err = NewDurableStream(opts)
+		require.NoError(t, err)
+		require.NoError(t, w.CloseWithError(nil))
+		lines, err := s.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"bar", "baz"}).Equal(t, lines)
+	})
+
+	t.Run("one stream per directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		w, s, err := NewDurableStream(DurableOptions{Dir: dir})
+		require.NoError(t, err)
+
+		_, _, err = NewDurableStream(DurableOptions{Dir: dir})
+		require.Error(t, err)
+		autogold.Expect("pipe: directory is in use by another durable stream").Equal(t, err.Error())
+
+		// The directory is released once the stream is read to completion.
+		require.NoError(t, w.CloseWithError(nil))
+		_, err = s.Lines()
+		require.NoError(t, err)
+		w, s, err = NewDurableStream(DurableOptions{Dir: dir})
+		require.NoError(t, err)
+
+		// The directory is released when the stream is closed, and writes error.
+		require.NoError(t, s.Close())
+		_, err = w.Write([]byte("foo\n"))
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+		_, _, err = NewDurableStream(DurableOptions{Dir: dir})
+		require.NoError(t, err)
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		t.Parallel()
+
+		w, s, err := NewDurableStream(DurableOptions{
+			Dir:            t.TempDir(),
+			SegmentSize:    10,
+			RetentionBytes: 20,
+		})
+		require.NoError(t, err)
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(w, "line %d\n", i)
+		}
+		w.CloseWithError(fmt.Errorf("oh no!"))
+
+		v, err := s.String()
+		require.Error(t, err)
+		assert.Equal(t, "oh no!", err.Error())
+		autogold.Expect("line 8\nline 9").Equal(t, strings.TrimSpace(v))
+	})
+}
@@ -0,0 +1,30 @@
+//go:build unix && !aix && !solaris
+
+package pipe
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockDurableDir locks dir with an advisory lock on a lock file, which is released by
+// the operating system if the process exits.
+func lockDurableDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, durableLockFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errDurableDirInUse
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockDurableDir releases a lock acquired with lockDurableDir.
+func unlockDurableDir(f *os.File) error { return f.Close() }
@@ -0,0 +1,173 @@
+package pipe
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LineWriter wraps a WriterErrorCloser shared by multiple concurrent writers, such as the
+// writer returned by NewStream, such that only complete lines are written to it. This
+// prevents output from concurrent writers from being interleaved within a line.
+//
+// Writes to the LineWriter itself are line-atomic, and NewWriter can be used to create
+// writers that each buffer their own incomplete lines, with an optional prefix or format
+// for each line. Lines are separated by '\n'.
+type LineWriter struct {
+	dst WriterErrorCloser
+
+	// mux guards all writes to dst and the state of all writers.
+	mux     sync.Mutex
+	writers []*lineBuffer
+	closed  bool
+
+	// def handles writes to the LineWriter itself.
+	def *lineBuffer
+}
+
+var _ WriterErrorCloser = (*LineWriter)(nil)
+
+// NewLineWriter creates a LineWriter that writes complete lines to dst.
+func NewLineWriter(dst WriterErrorCloser) *LineWriter {
+	lw := &LineWriter{dst: dst}
+	lw.def = lw.newBuffer("")
+	return lw
+}
+
+// NewWriter creates a writer that buffers incomplete lines separately from other writers,
+// and writes each complete line with the given prefix. The returned writer is safe for
+// concurrent use, but concurrent writes to the same writer may still interleave within
+// a line - each concurrent producer should have its own writer.
+//
+// Close flushes any incomplete line, terminated with a '\n', and prevents further writes
+// to the returned writer. It does not close the LineWriter.
+func (lw *LineWriter) NewWriter(prefix string) io.WriteCloser {
+	lw.mux.Lock()
+	defer lw.mux.Unlock()
+	return lw.newBuffer(prefix)
+}
+
+// NewWriterFunc is the same as NewWriter, but each complete line is written as the result
+// of format instead. format is called with each line without its '\n', and should return
+// a single line without a '\n'. It may modify and return the line it was provided.
+func (lw *LineWriter) NewWriterFunc(format func(line []byte) []byte) io.WriteCloser {
+	lw.mux.Lock()
+	defer lw.mux.Unlock()
+	b := &lineBuffer{lw: lw, format: format}
+	lw.writers = append(lw.writers, b)
+	return b
+}
+
+func (lw *LineWriter) newBuffer(prefix string) *lineBuffer {
+	b := &lineBuffer{lw: lw}
+	if prefix != "" {
+		p := []byte(prefix)
+		b.format = func(line []byte) []byte { return append(p[:len(p):len(p)], line...) }
+	}
+	lw.writers = append(lw.writers, b)
+	return b
+}
+
+// Write writes complete lines in p to the underlying writer, and buffers any trailing
+// incomplete line until it is completed by a subsequent Write.
+func (lw *LineWriter) Write(p []byte) (int, error) { return lw.def.Write(p) }
+
+// CloseWithError flushes the incomplete lines of all writers, each terminated with a
+// '\n', and closes the underlying writer with err.
+func (lw *LineWriter) CloseWithError(err error) error {
+	lw.mux.Lock()
+	defer lw.mux.Unlock()
+	if lw.closed {
+		return nil
+	}
+	lw.closed = true
+	for _, b := range lw.writers {
+		// Errors are propagated through the underlying writer, which we are closing.
+		_ = b.flush()
+		b.closed = true
+	}
+	lw.writers = nil
+	return lw.dst.CloseWithError(err)
+}
+
+// lineBuffer buffers an incomplete line for a single writer of a LineWriter.
+type lineBuffer struct {
+	lw *LineWriter
+	// format, if set, is applied to each complete line.
+	format func(line []byte) []byte
+
+	// partial and closed are guarded by lw.mux.
+	partial []byte
+	closed  bool
+}
+
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	b.lw.mux.Lock()
+	defer b.lw.mux.Unlock()
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	last := bytes.LastIndexByte(p, '\n')
+	if last < 0 {
+		b.partial = append(b.partial, p...)
+		return len(p), nil
+	}
+
+	var err error
+	if b.format == nil && len(b.partial) == 0 {
+		// Fast path - write complete lines as-is.
+		_, err = b.lw.dst.Write(p[:last+1])
+	} else {
+		b.partial = append(b.partial, p[:last+1]...)
+		_, err = b.lw.dst.Write(b.formatted(b.partial))
+	}
+	b.partial = append(b.partial[:0], p[last+1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (b *lineBuffer) Close() error {
+	b.lw.mux.Lock()
+	defer b.lw.mux.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for i, w := range b.lw.writers {
+		if w == b {
+			b.lw.writers = append(b.lw.writers[:i], b.lw.writers[i+1:]...)
+			break
+		}
+	}
+	return b.flush()
+}
+
+// flush writes the incomplete line, if any, terminated with a '\n'. It must be called
+// while holding lw.mux.
+func (b *lineBuffer) flush() error {
+	if len(b.partial) == 0 {
+		return nil
+	}
+	b.partial = append(b.partial, '\n')
+	_, err := b.lw.dst.Write(b.formatted(b.partial))
+	b.partial = b.partial[:0]
+	return err
+}
+
+// formatted returns lines, which must end with a '\n', with each line formatted.
+func (b *lineBuffer) formatted(lines []byte) []byte {
+	if b.format == nil {
+		return lines
+	}
+	out := make([]byte, 0, len(lines))
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		out = append(out, b.format(lines[:i])...)
+		out = append(out, '\n')
+		lines = lines[i+1:]
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package pipe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineWriter(t *testing.T) {
+	t.Run("concurrent writers", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewStream()
+		lw := NewLineWriter(w)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				writer := lw.NewWriter(fmt.Sprintf("[%d] ", i))
+				for j := 0; j < 100; j++ {
+					// Write lines in several parts
+					fmt.Fprintf(writer, "writer %d", i)
+					fmt.Fprintf(writer, " line %d\nwriter %d", j, i)
+					fmt.Fprintf(writer, " line %d.5\n", j)
+				}
+				writer.Close()
+			}(i)
+		}
+		go func() {
+			wg.Wait()
+			lw.CloseWithError(nil)
+		}()
+
+		var lines int
+		err := s.Stream(func(line string) {
+			var prefix, writer int
+			var rest string
+			_, err := fmt.Sscanf(line, "[%d] writer %d line %s", &prefix, &writer, &rest)
+			assert.NoError(t, err, line)
+			assert.Equal(t, prefix, writer, line)
+			lines++
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2000, lines)
+	})
+
+	t.Run("flush on close", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewStream()
+		lw := NewLineWriter(w)
+
+		a := lw.NewWriter("a: ")
+		b := lw.NewWriter("b: ")
+		a.Write([]byte("foo\nbar"))
+		b.Write([]byte("baz"))
+		lw.Write([]byte("unprefixed\n"))
+		require.NoError(t, b.Close())
+		_, err := b.Write([]byte("closed"))
+		assert.Error(t, err)
+		lw.Write([]byte("incomplete"))
+		lw.CloseWithError(errors.New("oh no!"))
+
+		lines, err := s.Lines()
+		require.Error(t, err)
+		assert.Equal(t, "oh no!", err.Error())
+		autogold.Expect([]string{"a: foo", "unprefixed", "b: baz", "incomplete", "a: bar"}).Equal(t, lines)
+
+		_, err = a.Write([]byte("closed"))
+		assert.Error(t, err)
+	})
+
+	t.Run("multiple lines with prefix", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewStream()
+		lw := NewLineWriter(w)
+		lw.NewWriter("> ").Write([]byte("foo\nbar\n\nbaz\n"))
+		lw.CloseWithError(nil)
+
+		v, err := s.String()
+		require.NoError(t, err)
+		assert.Equal(t, "> foo\n> bar\n> \n> baz", strings.TrimSuffix(v, "\n"))
+	})
+	t.Run("NewWriterFunc", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewStream()
+		lw := NewLineWriter(w)
+		writer := lw.NewWriterFunc(func(line []byte) []byte {
+			return []byte(strings.ToUpper(string(line)))
+		})
+		writer.Write([]byte("foo\nba"))
+		writer.Write([]byte("r\nbaz"))
+		lw.CloseWithError(nil)
+
+		v, err := s.String()
+		require.NoError(t, err)
+		autogold.Expect("FOO\nBAR\nBAZ").Equal(t, v)
+	})
+}
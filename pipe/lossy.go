@@ -0,0 +1,324 @@
+package pipe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"go.bobheadxi.dev/streamline"
+)
+
+// OverflowPolicy determines which lines are dropped when the buffer of a stream created
+// by NewLossyStream is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest drops the oldest buffered lines to make room for new lines. It is the
+	// default policy.
+	DropOldest OverflowPolicy = iota
+	// DropNewest drops new lines until there is room in the buffer.
+	DropNewest
+	// Sample keeps one in every LossyOptions.SampleRate new lines, dropping the oldest
+	// buffered lines to make room, and drops the rest.
+	Sample
+)
+
+// DefaultLossyMaxLineBytes is the maximum length of a line in a stream created by
+// NewLossyStream if LossyOptions.MaxBytes is not set. Longer lines are dropped.
+const DefaultLossyMaxLineBytes = 64 * 1024
+
+// LossyOptions configures NewLossyStream.
+type LossyOptions struct {
+	// MaxLines is the maximum number of lines to buffer. If both MaxLines and MaxBytes
+	// are zero, the default is 1000 lines.
+	MaxLines int
+	// MaxBytes is the maximum number of bytes to buffer, excluding line separators. Lines
+	// longer than MaxBytes are dropped. If MaxBytes is zero, lines longer than
+	// DefaultLossyMaxLineBytes are dropped.
+	MaxBytes int
+	// Policy determines which lines are dropped when the buffer is full.
+	Policy OverflowPolicy
+	// SampleRate configures the Sample policy to keep one in every SampleRate lines
+	// written while the buffer is full. The default is 10.
+	SampleRate int
+	// DropMarker, if true, injects a "[N lines dropped]" line where lines were dropped.
+	DropMarker bool
+}
+
+// LossyWriter is the write end of a stream created by NewLossyStream. Writes never block,
+// and dropped lines are counted.
+type LossyWriter struct {
+	opts LossyOptions
+
+	mux  sync.Mutex
+	cond *sync.Cond
+
+	// lines are the buffered lines, and bytes is their total size.
+	lines []lossyLine
+	bytes int
+	// partial holds the incomplete last line written.
+	partial []byte
+	// oversized indicates that the incomplete last line is too long to be buffered, and
+	// will be dropped once it is complete.
+	oversized bool
+	// dropped is the number of dropped lines that are not attributed to a buffered line
+	// yet.
+	dropped int
+	// overflows counts lines written while the buffer is full, for sampling.
+	overflows int
+
+	written      uint64
+	totalDropped uint64
+
+	closed bool
+	err    error
+}
+
+type lossyLine struct {
+	data []byte
+	// droppedBefore is the number of lines dropped before this line.
+	droppedBefore int
+}
+
+var _ WriterErrorCloser = (*LossyWriter)(nil)
+
+// NewLossyStream creates a Stream that consumes and emits data written to the returned
+// writer, piped through a fixed-size in-memory buffer of lines. Unlike NewBoundedStream,
+// writes never block when the buffer is full - instead, whole lines are dropped according
+// to the configured OverflowPolicy. This is useful for live displays of output, where
+// recent output matters more than complete output.
+//
+// The returned LossyWriter must be closed by the caller when all data has been written
+// or when an error occurs at the source to indicate to the stream that no further data
+// will become available. Lines are separated by '\n'.
+func NewLossyStream(opts LossyOptions) (writer *LossyWriter, stream *streamline.Stream) {
+	if opts.MaxLines <= 0 && opts.MaxBytes <= 0 {
+		opts.MaxLines = 1000
+	}
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = 10
+	}
+	w := &LossyWriter{opts: opts}
+	w.cond = sync.NewCond(&w.mux)
+	return w, streamline.New(&lossyReader{w: w})
+}
+
+// Write buffers complete lines in p, dropping lines if the buffer is full. It never
+// blocks.
+func (w *LossyWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.appendPartial(p)
+			break
+		}
+		if len(w.partial) > 0 || w.oversized {
+			w.appendPartial(p[:i])
+			w.commitPartial()
+		} else {
+			w.commit(p[:i])
+		}
+		p = p[i+1:]
+	}
+	w.cond.Broadcast()
+	return n, nil
+}
+
+// CloseWithError prevents further writes and propagates the error to Stream readers once
+// the buffered lines have been read. An incomplete last line is retained.
+func (w *LossyWriter) CloseWithError(err error) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil
+	}
+	if len(w.partial) > 0 || w.oversized {
+		w.commitPartial()
+		w.partial = nil
+	}
+	w.closed = true
+	w.err = err
+	w.cond.Broadcast()
+	return nil
+}
+
+// Written returns the total number of lines written, including dropped lines.
+func (w *LossyWriter) Written() uint64 {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.written
+}
+
+// Dropped returns the total number of lines dropped.
+func (w *LossyWriter) Dropped() uint64 {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.totalDropped
+}
+
+// maxLineBytes is the maximum length of a line that can be buffered.
+func (w *LossyWriter) maxLineBytes() int {
+	if w.opts.MaxBytes > 0 {
+		return w.opts.MaxBytes
+	}
+	return DefaultLossyMaxLineBytes
+}
+
+// appendPartial appends p to the incomplete last line, discarding the line if it becomes
+// too long to be buffered. It must be called while holding w.mux.
+func (w *LossyWriter) appendPartial(p []byte) {
+	if w.oversized {
+		return
+	}
+	if len(w.partial)+len(p) > w.maxLineBytes() {
+		w.oversized = true
+		w.partial = w.partial[:0]
+		return
+	}
+	w.partial = append(w.partial, p...)
+}
+
+// commitPartial commits the incomplete last line. It must be called while holding w.mux.
+func (w *LossyWriter) commitPartial() {
+	if w.oversized {
+		w.written++
+		w.drop()
+		w.oversized = false
+	} else {
+		w.commit(w.partial)
+	}
+	w.partial = w.partial[:0]
+}
+
+// commit adds a complete line to the buffer, dropping lines that are too long to be
+// buffered. It must be called while holding w.mux.
+func (w *LossyWriter) commit(line []byte) {
+	if len(line) > w.maxLineBytes() {
+		w.written++
+		w.drop()
+		return
+	}
+	w.commitLine(line)
+}
+
+// commitLine adds a line to the buffer, dropping lines according to the policy.
+func (w *LossyWriter) commitLine(line []byte) {
+	w.written++
+
+	if w.full(len(line)) {
+		w.overflows++
+		switch {
+		case w.opts.Policy == DropNewest,
+			w.opts.Policy == Sample && (w.overflows-1)%w.opts.SampleRate != 0:
+			w.drop()
+			return
+		}
+		for len(w.lines) > 0 && w.full(len(line)) {
+			w.dropOldest()
+		}
+	} else {
+		w.overflows = 0
+	}
+
+	w.lines = append(w.lines, lossyLine{
+		data:          append([]byte(nil), line...),
+		droppedBefore: w.dropped,
+	})
+	w.bytes += len(line)
+	w.dropped = 0
+}
+
+// full indicates if there is no room in the buffer for a line of size n.
+func (w *LossyWriter) full(n int) bool {
+	return (w.opts.MaxLines > 0 && len(w.lines) >= w.opts.MaxLines) ||
+		(w.opts.MaxBytes > 0 && w.bytes+n > w.opts.MaxBytes)
+}
+
+// drop records a dropped line that is not buffered.
+func (w *LossyWriter) drop() {
+	w.dropped++
+	w.totalDropped++
+}
+
+// dropOldest drops the oldest buffered line.
+func (w *LossyWriter) dropOldest() {
+	oldest := w.lines[0]
+	w.lines[0] = lossyLine{}
+	w.lines = w.lines[1:]
+	w.bytes -= len(oldest.data)
+	w.totalDropped++
+
+	// Attribute the drop to the next line.
+	dropped := oldest.droppedBefore + 1
+	if len(w.lines) > 0 {
+		w.lines[0].droppedBefore += dropped
+	} else {
+		w.dropped += dropped
+	}
+}
+
+// lossyReader reads lines from a LossyWriter.
+type lossyReader struct {
+	w *LossyWriter
+	// current holds the remainder of the line being read.
+	current []byte
+}
+
+func (r *lossyReader) Read(p []byte) (int, error) {
+	if len(r.current) == 0 {
+		next, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		r.current = next
+	}
+	n := copy(p, r.current)
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// next blocks until a line is available, and returns it with a trailing line separator,
+// preceded by a drop marker if configured.
+func (r *lossyReader) next() ([]byte, error) {
+	w := r.w
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	for len(w.lines) == 0 {
+		if w.closed {
+			if w.dropped > 0 && w.opts.DropMarker {
+				marker := dropMarker(w.dropped)
+				w.dropped = 0
+				return marker, nil
+			}
+			if w.err != nil {
+				return nil, w.err
+			}
+			return nil, io.EOF
+		}
+		w.cond.Wait()
+	}
+
+	line := w.lines[0]
+	w.lines[0] = lossyLine{}
+	w.lines = w.lines[1:]
+	w.bytes -= len(line.data)
+
+	data := append(line.data, '\n')
+	if line.droppedBefore > 0 && w.opts.DropMarker {
+		data = append(dropMarker(line.droppedBefore), data...)
+	}
+	return data, nil
+}
+
+func dropMarker(n int) []byte {
+	return []byte(fmt.Sprintf("[%d lines dropped]\n", n))
+}
@@ -0,0 +1,148 @@
+package pipe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLossyStream(t *testing.T) {
+	writeLines := func(w *LossyWriter, n int) {
+		for i := 1; i <= n; i++ {
+			// Split writes across line boundaries
+			fmt.Fprintf(w, "line %d", i)
+			w.Write([]byte("\n"))
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		opts        LossyOptions
+		lines       int
+		want        autogold.Value
+		wantDropped uint64
+	}{
+		{
+			name:  "no overflow",
+			opts:  LossyOptions{MaxLines: 5},
+			lines: 3,
+			want:  autogold.Expect([]string{"line 1", "line 2", "line 3"}),
+		},
+		{
+			name:        "drop oldest",
+			opts:        LossyOptions{MaxLines: 3},
+			lines:       6,
+			want:        autogold.Expect([]string{"line 4", "line 5", "line 6"}),
+			wantDropped: 3,
+		},
+		{
+			name:        "drop oldest with marker",
+			opts:        LossyOptions{MaxLines: 3, DropMarker: true},
+			lines:       6,
+			want:        autogold.Expect([]string{"[3 lines dropped]", "line 4", "line 5", "line 6"}),
+			wantDropped: 3,
+		},
+		{
+			name:        "drop newest with marker",
+			opts:        LossyOptions{MaxLines: 3, Policy: DropNewest, DropMarker: true},
+			lines:       6,
+			want:        autogold.Expect([]string{"line 1", "line 2", "line 3", "[3 lines dropped]"}),
+			wantDropped: 3,
+		},
+		{
+			name:  "sample with marker",
+			opts:  LossyOptions{MaxLines: 3, Policy: Sample, SampleRate: 2, DropMarker: true},
+			lines: 8,
+			want: autogold.Expect([]string{
+				"[3 lines dropped]", "line 4", "[1 lines dropped]", "line 6",
+				"[1 lines dropped]",
+				"line 8",
+			}),
+			wantDropped: 5,
+		},
+		{
+			name:        "max bytes",
+			opts:        LossyOptions{MaxBytes: 14, DropMarker: true},
+			lines:       4,
+			want:        autogold.Expect([]string{"[2 lines dropped]", "line 3", "line 4"}),
+			wantDropped: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			w, s := NewLossyStream(tc.opts)
+			writeLines(w, tc.lines)
+			w.CloseWithError(nil)
+
+			lines, err := s.Lines()
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+			assert.Equal(t, uint64(tc.lines), w.Written())
+			assert.Equal(t, tc.wantDropped, w.Dropped())
+		})
+	}
+
+	t.Run("concurrent read and write", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewLossyStream(LossyOptions{MaxLines: 10, DropMarker: true})
+		go func() {
+			writeLines(w, 10000)
+			w.CloseWithError(errors.New("oh no!"))
+		}()
+
+		var lines, markers int
+		err := s.Stream(func(line string) {
+			if strings.HasSuffix(line, "lines dropped]") {
+				markers++
+			} else {
+				assert.True(t, strings.HasPrefix(line, "line "))
+				lines++
+			}
+		})
+		require.Error(t, err)
+		assert.Equal(t, "oh no!", err.Error())
+		assert.Equal(t, uint64(10000), uint64(lines)+w.Dropped())
+	})
+
+	t.Run("long lines are dropped", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewLossyStream(LossyOptions{MaxBytes: 8, DropMarker: true})
+		w.Write([]byte("abc\nabcdefghij\nab"))
+		w.Write([]byte("cdefghi\nabcd\nabcdefghijk"))
+		w.CloseWithError(nil)
+
+		lines, err := s.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"abc", "[2 lines dropped]", "abcd", "[1 lines dropped]"}).Equal(t, lines)
+		assert.Equal(t, uint64(5), w.Written())
+		assert.Equal(t, uint64(3), w.Dropped())
+	})
+
+	t.Run("incomplete lines are bounded without MaxBytes", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewLossyStream(LossyOptions{MaxLines: 10})
+		chunk := bytes.Repeat([]byte("a"), 1024)
+		for i := 0; i < 2*DefaultLossyMaxLineBytes/len(chunk); i++ {
+			w.Write(chunk)
+		}
+		assert.LessOrEqual(t, cap(w.partial), 2*DefaultLossyMaxLineBytes)
+		w.Write([]byte("\nfoo"))
+		w.CloseWithError(nil)
+
+		lines, err := s.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"foo"}).Equal(t, lines)
+		assert.Equal(t, uint64(1), w.Dropped())
+	})
+}
@@ -0,0 +1,271 @@
+package pipe
+
+import (
+	"sync"
+	"time"
+
+	"github.com/djherbis/buffer"
+)
+
+// Stats is a snapshot of the usage of a stream's buffer.
+type Stats struct {
+	// MemoryBytes is the number of unread bytes buffered in memory.
+	MemoryBytes int64
+	// DiskBytes is the number of unread bytes buffered in files.
+	DiskBytes int64
+	// SpillFiles is the number of files currently used to buffer data.
+	SpillFiles int
+
+	// BytesWritten and BytesRead are the total number of bytes written to and read from
+	// the buffer.
+	BytesWritten, BytesRead int64
+	// WriteThroughput and ReadThroughput are the average number of bytes written and read
+	// per second since the stream was created.
+	WriteThroughput, ReadThroughput float64
+
+	// ReaderLag is how long the oldest unread data has been buffered.
+	ReaderLag time.Duration
+	// MaxReaderLag is the longest time any data was buffered before it was read.
+	MaxReaderLag time.Duration
+}
+
+// Threshold indicates a statistic that is monitored with Thresholds.
+type Threshold int
+
+const (
+	// ThresholdMemoryBytes is crossed by Stats.MemoryBytes.
+	ThresholdMemoryBytes Threshold = iota + 1
+	// ThresholdDiskBytes is crossed by Stats.DiskBytes.
+	ThresholdDiskBytes
+	// ThresholdSpillFiles is crossed by Stats.SpillFiles.
+	ThresholdSpillFiles
+	// ThresholdReaderLag is crossed by Stats.ReaderLag.
+	ThresholdReaderLag
+)
+
+func (t Threshold) String() string {
+	switch t {
+	case ThresholdMemoryBytes:
+		return "memory bytes"
+	case ThresholdDiskBytes:
+		return "disk bytes"
+	case ThresholdSpillFiles:
+		return "spill files"
+	case ThresholdReaderLag:
+		return "reader lag"
+	default:
+		return "unknown"
+	}
+}
+
+// Thresholds configures the values at which Monitor.OnThreshold is called. Zero values
+// are not monitored.
+type Thresholds struct {
+	MemoryBytes int64
+	DiskBytes   int64
+	SpillFiles  int
+	ReaderLag   time.Duration
+}
+
+// Monitor collects live statistics about the buffer of a stream created with
+// NewStreamWithOptions, configured with Options.Monitor. A Monitor must not be shared
+// between streams.
+//
+//	monitor := &pipe.Monitor{
+//		Thresholds: pipe.Thresholds{DiskBytes: 1 << 30},
+//		OnThreshold: func(t pipe.Threshold, exceeded bool, stats pipe.Stats) {
+//			log.Printf("%s threshold exceeded: %t", t, exceeded)
+//		},
+//	}
+//	writer, stream := pipe.NewStreamWithOptions(pipe.Options{Monitor: monitor})
+type Monitor struct {
+	// Thresholds configures when OnThreshold is called.
+	Thresholds Thresholds
+	// OnThreshold, if set, is called when a statistic exceeds its configured threshold,
+	// and again when it no longer exceeds the threshold. It is called from the goroutine
+	// writing to or reading from the stream, without holding any locks on the buffer, so
+	// blocking in OnThreshold can be used to apply backpressure to writers.
+	OnThreshold func(t Threshold, exceeded bool, stats Stats)
+
+	// mux guards the state below.
+	mux      sync.Mutex
+	started  time.Time
+	stats    Stats
+	exceeded map[Threshold]bool
+	// writes records when each unread write happened, by the offset of its end.
+	writes []monitoredWrite
+	// pending are threshold events that have not been dispatched yet.
+	pending []thresholdEvent
+
+	// dispatchMux serializes calls to OnThreshold.
+	dispatchMux sync.Mutex
+}
+
+type monitoredWrite struct {
+	end int64
+	at  time.Time
+}
+
+type thresholdEvent struct {
+	threshold Threshold
+	exceeded  bool
+	stats     Stats
+}
+
+// Stats returns a snapshot of the buffer's current statistics.
+func (m *Monitor) Stats() Stats {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.snapshot(time.Now())
+}
+
+func (m *Monitor) start() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.started = time.Now()
+	m.exceeded = make(map[Threshold]bool)
+}
+
+// snapshot returns the current stats. It must be called while holding m.mux.
+func (m *Monitor) snapshot(now time.Time) Stats {
+	stats := m.stats
+	if elapsed := now.Sub(m.started).Seconds(); elapsed > 0 {
+		stats.WriteThroughput = float64(stats.BytesWritten) / elapsed
+		stats.ReadThroughput = float64(stats.BytesRead) / elapsed
+	}
+	if len(m.writes) > 0 {
+		stats.ReaderLag = now.Sub(m.writes[0].at)
+	}
+	return stats
+}
+
+// update records the state of the buffer, and queues threshold events. It is called while
+// the buffer is locked. Thresholds are only checked when the buffer is accessed.
+func (m *Monitor) update(b *monitoredBuffer, written, read int) {
+	now := time.Now()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.stats.MemoryBytes = b.memory.Len()
+	if b.files != nil {
+		m.stats.DiskBytes = b.files.Len()
+		m.stats.SpillFiles = b.pool.files
+	}
+	if written > 0 {
+		m.stats.BytesWritten += int64(written)
+		m.writes = append(m.writes, monitoredWrite{end: m.stats.BytesWritten, at: now})
+	}
+	if read > 0 {
+		// The lag of this read is the age of the first write it consumed.
+		if lag := now.Sub(m.writes[0].at); lag > m.stats.MaxReaderLag {
+			m.stats.MaxReaderLag = lag
+		}
+		m.stats.BytesRead += int64(read)
+		for len(m.writes) > 0 && m.writes[0].end <= m.stats.BytesRead {
+			m.writes = m.writes[1:]
+		}
+	}
+	if b.Len() == 0 {
+		// The buffer may have been reset.
+		m.writes = nil
+	}
+
+	if m.OnThreshold == nil {
+		return
+	}
+	stats := m.snapshot(now)
+	m.check(ThresholdMemoryBytes, m.Thresholds.MemoryBytes > 0 && stats.MemoryBytes > m.Thresholds.MemoryBytes, stats)
+	m.check(ThresholdDiskBytes, m.Thresholds.DiskBytes > 0 && stats.DiskBytes > m.Thresholds.DiskBytes, stats)
+	m.check(ThresholdSpillFiles, m.Thresholds.SpillFiles > 0 && stats.SpillFiles > m.Thresholds.SpillFiles, stats)
+	m.check(ThresholdReaderLag, m.Thresholds.ReaderLag > 0 && stats.ReaderLag > m.Thresholds.ReaderLag, stats)
+}
+
+// check queues an event if the threshold state has changed. It must be called while
+// holding m.mux.
+func (m *Monitor) check(t Threshold, exceeded bool, stats Stats) {
+	if m.exceeded[t] == exceeded {
+		return
+	}
+	m.exceeded[t] = exceeded
+	m.pending = append(m.pending, thresholdEvent{threshold: t, exceeded: exceeded, stats: stats})
+}
+
+// dispatch calls OnThreshold with pending events. It must be called without holding any
+// locks on the buffer.
+func (m *Monitor) dispatch() {
+	if m.OnThreshold == nil {
+		return
+	}
+	m.dispatchMux.Lock()
+	defer m.dispatchMux.Unlock()
+
+	m.mux.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.mux.Unlock()
+
+	for _, e := range pending {
+		m.OnThreshold(e.threshold, e.exceeded, e.stats)
+	}
+}
+
+// monitoredBuffer reports the state of a buffer to a Monitor. Pipes only access the
+// buffer while holding a lock, so its components can be safely inspected on each access.
+type monitoredBuffer struct {
+	buffer.Buffer
+	monitor *Monitor
+
+	memory buffer.Buffer
+	// files and pool are nil if the buffer does not store data in files.
+	files buffer.Buffer
+	pool  *countingPool
+}
+
+func (b *monitoredBuffer) Write(p []byte) (int, error) {
+	n, err := b.Buffer.Write(p)
+	b.monitor.update(b, n, 0)
+	return n, err
+}
+
+func (b *monitoredBuffer) Read(p []byte) (int, error) {
+	n, err := b.Buffer.Read(p)
+	b.monitor.update(b, 0, n)
+	return n, err
+}
+
+func (b *monitoredBuffer) Reset() {
+	b.Buffer.Reset()
+	b.monitor.update(b, 0, 0)
+}
+
+// countingPool counts the files created by a file pool. It is only accessed while the
+// buffer is locked.
+type countingPool struct {
+	buffer.Pool
+	files int
+}
+
+func (p *countingPool) Get() (buffer.Buffer, error) {
+	b, err := p.Pool.Get()
+	if err == nil {
+		p.files++
+	}
+	return b, err
+}
+
+func (p *countingPool) Put(b buffer.Buffer) error {
+	p.files--
+	return p.Pool.Put(b)
+}
+
+// monitoredWriter dispatches threshold events after each write.
+type monitoredWriter struct {
+	WriterErrorCloser
+	monitor *Monitor
+}
+
+func (w *monitoredWriter) Write(p []byte) (int, error) {
+	n, err := w.WriterErrorCloser.Write(p)
+	w.monitor.dispatch()
+	return n, err
+}
@@ -0,0 +1,102 @@
+package pipe
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	t.Run("stats", func(t *testing.T) {
+		t.Parallel()
+
+		monitor := &Monitor{}
+		w, s := NewStreamWithOptions(Options{
+			MemoryLimit:   100,
+			FileChunkSize: 100,
+			TempDir:       t.TempDir(),
+			Monitor:       monitor,
+		})
+
+		_, err := w.Write(bytes.Repeat([]byte("a\n"), 175))
+		require.NoError(t, err)
+
+		stats := monitor.Stats()
+		assert.Equal(t, int64(100), stats.MemoryBytes)
+		assert.Equal(t, int64(250), stats.DiskBytes)
+		assert.Equal(t, 3, stats.SpillFiles)
+		assert.Equal(t, int64(350), stats.BytesWritten)
+		assert.Zero(t, stats.BytesRead)
+		assert.NotZero(t, stats.WriteThroughput)
+
+		time.Sleep(10 * time.Millisecond)
+		assert.GreaterOrEqual(t, monitor.Stats().ReaderLag, 10*time.Millisecond)
+
+		w.CloseWithError(nil)
+		_, err = io.ReadAll(s)
+		require.NoError(t, err)
+
+		stats = monitor.Stats()
+		assert.Zero(t, stats.MemoryBytes)
+		assert.Zero(t, stats.DiskBytes)
+		assert.Zero(t, stats.SpillFiles)
+		assert.Equal(t, int64(350), stats.BytesRead)
+		assert.NotZero(t, stats.ReadThroughput)
+		assert.Zero(t, stats.ReaderLag)
+		assert.GreaterOrEqual(t, stats.MaxReaderLag, 10*time.Millisecond)
+	})
+
+	t.Run("thresholds", func(t *testing.T) {
+		t.Parallel()
+
+		type event struct {
+			threshold Threshold
+			exceeded  bool
+		}
+		var mux sync.Mutex
+		var events []event
+		monitor := &Monitor{
+			Thresholds: Thresholds{MemoryBytes: 50, DiskBytes: 100, SpillFiles: 1},
+			OnThreshold: func(t Threshold, exceeded bool, stats Stats) {
+				mux.Lock()
+				defer mux.Unlock()
+				events = append(events, event{t, exceeded})
+			},
+		}
+		w, s := NewStreamWithOptions(Options{
+			MemoryLimit:   100,
+			FileChunkSize: 100,
+			TempDir:       t.TempDir(),
+			Monitor:       monitor,
+		})
+
+		_, err := w.Write(bytes.Repeat([]byte("a\n"), 175))
+		require.NoError(t, err)
+
+		mux.Lock()
+		assert.Equal(t, []event{
+			{ThresholdMemoryBytes, true},
+			{ThresholdDiskBytes, true},
+			{ThresholdSpillFiles, true},
+		}, events)
+		events = nil
+		mux.Unlock()
+
+		w.CloseWithError(nil)
+		_, err = io.ReadAll(s)
+		require.NoError(t, err)
+
+		mux.Lock()
+		assert.ElementsMatch(t, []event{
+			{ThresholdMemoryBytes, false},
+			{ThresholdDiskBytes, false},
+			{ThresholdSpillFiles, false},
+		}, events)
+		mux.Unlock()
+	})
+}
@@ -2,7 +2,9 @@ package pipe
 
 import (
 	"io"
+	"sync"
 
+	"github.com/djherbis/buffer"
 	// We use this buffered pipe from github.com/djherbis/nio that allows async read and
 	// write operations to the reader and writer portions of the pipe respectively.
 	"github.com/djherbis/nio/v3"
@@ -28,15 +30,12 @@ type WriterErrorCloser interface {
 // written or when an error occurs at the source to indicate to the stream that no further
 // data will become available.
 //
-// For a purely in-memory buffer, NewBoundedStream can be used. For more advanced
-// configurations, consider configuring a pipe directly using github.com/djherbis/nio/v3
-// or a pipe of your choice and configuring a Stream over the reader with streamline.New().
+// For a purely in-memory buffer, NewBoundedStream can be used. To configure the buffer
+// for this stream only, use NewStreamWithOptions. For more advanced configurations,
+// consider configuring a pipe directly using github.com/djherbis/nio/v3 or a pipe of your
+// choice and configuring a Stream over the reader with streamline.New().
 func NewStream() (writer WriterErrorCloser, stream *streamline.Stream) {
-	outputBuffer := makeUnboundedBuffer()
-
-	outputReader, outputWriter := nio.Pipe(outputBuffer)
-
-	return outputWriter, streamline.New(outputReader)
+	return newStream(makeUnboundedBuffer(), nil)
 }
 
 // NewBoundedStream creates a Stream that consumes and emits data written to the returned
@@ -54,9 +53,63 @@ func NewStream() (writer WriterErrorCloser, stream *streamline.Stream) {
 // github.com/djherbis/nio/v3 or a pipe of your choice and configuring a Stream over the
 // reader with streamline.New().
 func NewBoundedStream() (writer WriterErrorCloser, stream *streamline.Stream) {
-	outputBuffer := makeMemoryBuffer()
+	return newStream(makeMemoryBuffer(), nil)
+}
+
+// NewStreamWithOptions is the same as NewStream, but pipes data through a buffer
+// configured with opts instead of the package defaults.
+//
+// Files created to store overflows are removed as their contents are read, and any
+// remaining files are removed once the Stream has been read to completion after the
+// writer is closed, or once the Stream is closed with (*Stream).Close().
+func NewStreamWithOptions(opts Options) (writer WriterErrorCloser, stream *streamline.Stream) {
+	return newStream(opts.makeBuffer(), opts.Monitor)
+}
+
+func newStream(b buffer.Buffer, monitor *Monitor) (WriterErrorCloser, *streamline.Stream) {
+	outputReader, outputWriter := nio.Pipe(b)
 
-	outputReader, outputWriter := nio.Pipe(outputBuffer)
+	reader := &releasingReader{PipeReader: outputReader, buffer: b, monitor: monitor}
+	if monitor != nil {
+		return &monitoredWriter{WriterErrorCloser: outputWriter, monitor: monitor}, streamline.New(reader)
+	}
+	return outputWriter, streamline.New(reader)
+}
+
+// releasingReader resets the buffer once the pipe has been read to completion or closed,
+// which removes any files still held by the buffer.
+type releasingReader struct {
+	*nio.PipeReader
+	buffer buffer.Buffer
+	// monitor, if set, has threshold events dispatched after each read.
+	monitor *Monitor
+
+	// mux guards buffer against Close during a read.
+	mux sync.Mutex
+}
+
+func (r *releasingReader) Read(p []byte) (int, error) {
+	r.mux.Lock()
+	n, err := r.PipeReader.Read(p)
+	if n == 0 && err != nil {
+		// Reads only return an error once the buffer is empty and the writer is closed,
+		// or the reader is closed, so there can be no further writes to the buffer.
+		r.buffer.Reset()
+	}
+	r.mux.Unlock()
+	if r.monitor != nil {
+		r.monitor.dispatch()
+	}
+	return n, err
+}
 
-	return outputWriter, streamline.New(outputReader)
+// Close closes the pipe, causing further writes to error, and releases the buffer.
+func (r *releasingReader) Close() error {
+	// Closing the pipe unblocks any pending read, and prevents further writes to the
+	// buffer, so the buffer can be reset once pending reads are done.
+	err := r.PipeReader.Close()
+	r.mux.Lock()
+	r.buffer.Reset()
+	r.mux.Unlock()
+	return err
 }
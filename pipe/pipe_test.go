@@ -1,10 +1,13 @@
 package pipe
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,6 +50,116 @@ func TestBoundedStream(t *testing.T) {
 	assert.Equal(t, size, read.Len()-1) // we append an extra newline
 }
 
+func TestStreamWithOptions(t *testing.T) {
+	t.Run("spill files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		w, s := NewStreamWithOptions(Options{
+			MemoryLimit:   1024,
+			FileChunkSize: 64 * 1024,
+			TempDir:       dir,
+		})
+
+		input, size, _ := testdata.GenerateLargeInput(1)
+		_, err := io.Copy(w, input)
+		require.NoError(t, err)
+		w.CloseWithError(nil)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.NotEmpty(t, files)
+
+		var read strings.Builder
+		err = s.Stream(func(line string) { read.WriteString(line + "\n") })
+		assert.NoError(t, err)
+		assert.Equal(t, size, read.Len()-1) // we append an extra newline
+
+		files, err = os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("spill files released on Close", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		w, s := NewStreamWithOptions(Options{
+			MemoryLimit:   1024,
+			FileChunkSize: 64 * 1024,
+			TempDir:       dir,
+		})
+
+		input, _, _ := testdata.GenerateLargeInput(1)
+		_, err := io.Copy(w, input)
+		require.NoError(t, err)
+
+		// Stop reading early, without the writer being closed.
+		errStop := errors.New("stop")
+		err = s.StreamBytes(func([]byte) error { return errStop })
+		assert.ErrorIs(t, err, errStop)
+		require.NoError(t, s.Close())
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+
+		_, err = w.Write([]byte("foo\n"))
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	})
+
+	t.Run("max disk bytes", func(t *testing.T) {
+		t.Parallel()
+
+		w, s := NewStreamWithOptions(Options{
+			MemoryLimit:   16,
+			FileChunkSize: 16,
+			TempDir:       t.TempDir(),
+			MaxDiskBytes:  32,
+		})
+
+		written := make(chan int)
+		go func() {
+			n, _ := w.Write(bytes.Repeat([]byte("a"), 100))
+			w.CloseWithError(nil)
+			written <- n
+		}()
+
+		// Write should block until there is space
+		select {
+		case <-written:
+			t.Fatal("unexpected write completion")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		v, err := s.String()
+		assert.NoError(t, err)
+		assert.Len(t, v, 100)
+		assert.Equal(t, 100, <-written)
+	})
+
+	t.Run("memory only", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		w, s := NewStreamWithOptions(Options{
+			MemoryLimit:  16,
+			TempDir:      dir,
+			MaxDiskBytes: -1,
+		})
+		go func() {
+			w.Write(bytes.Repeat([]byte("a"), 100))
+			files, _ := os.ReadDir(dir)
+			w.CloseWithError(nil)
+			assert.Empty(t, files)
+		}()
+
+		v, err := s.String()
+		assert.NoError(t, err)
+		assert.Len(t, v, 100)
+	})
+}
+
 func TestWriterErrorCloser(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,463 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys that are commonly used for the timestamp, level, and message of structured log
+// entries, in order of preference.
+var (
+	timestampKeys = []string{"timestamp", "time", "ts", "@timestamp", "t"}
+	levelKeys     = []string{"level", "lvl", "severity", "@level"}
+	messageKeys   = []string{"message", "msg", "@message"}
+)
+
+// timestampLayouts are tried in order when parsing string timestamps from structured
+// log entries.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05.999999999-0700",
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// ParseJSONLog parses a line that is a JSON object. Common keys for the timestamp,
+// level, and message are extracted into the LogEntry, and all other keys are retained
+// as fields.
+func ParseJSONLog(line []byte) (LogEntry, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return LogEntry{}, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return LogEntry{}, false
+	}
+	// Reject trailing garbage after the object.
+	if dec.More() {
+		return LogEntry{}, false
+	}
+	return entryFromFields(fields), true
+}
+
+// ParseLogfmtLog parses a line of space-separated key=value pairs, where values may be
+// quoted. Every token in the line must be a key=value pair. Common keys for the
+// timestamp, level, and message are extracted into the LogEntry, and all other keys are
+// retained as string fields.
+func ParseLogfmtLog(line []byte) (LogEntry, bool) {
+	fields := make(map[string]any)
+	s := string(line)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+
+		// Read the key, which must be followed by '='.
+		eq := strings.IndexAny(s, "= \t\"")
+		if eq <= 0 || s[eq] != '=' {
+			return LogEntry{}, false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		// Read the value, which may be quoted.
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := quotedEnd(s)
+			if end < 0 {
+				return LogEntry{}, false
+			}
+			unquoted, err := strconv.Unquote(s[:end])
+			if err != nil {
+				return LogEntry{}, false
+			}
+			value, s = unquoted, s[end:]
+			if s != "" && s[0] != ' ' && s[0] != '\t' {
+				return LogEntry{}, false
+			}
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+			if strings.ContainsAny(value, `="`) {
+				return LogEntry{}, false
+			}
+		}
+		fields[key] = value
+	}
+	if len(fields) == 0 {
+		return LogEntry{}, false
+	}
+	return entryFromFields(fields), true
+}
+
+// quotedEnd returns the index just after the closing quote of the quoted string at the
+// start of s, or -1 if the string is not terminated.
+func quotedEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// combinedLogPattern matches the Apache/nginx combined log format, as well as the common
+// log format, which omits the referer and user agent.
+var combinedLogPattern = regexp.MustCompile(
+	`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// ParseCombinedLog parses a line in the Apache/nginx combined or common log format. The
+// request line is used as the message, and the level is derived from the response
+// status: 5xx responses are errors, 4xx responses are warnings, and all other responses
+// are info.
+func ParseCombinedLog(line []byte) (LogEntry, bool) {
+	m := combinedLogPattern.FindSubmatch(line)
+	if m == nil {
+		return LogEntry{}, false
+	}
+	ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(m[4]))
+	if err != nil {
+		return LogEntry{}, false
+	}
+	status, _ := strconv.Atoi(string(m[6]))
+
+	fields := map[string]any{
+		"remote_addr": string(m[1]),
+		"status":      status,
+	}
+	setIfPresent(fields, "ident", string(m[2]))
+	setIfPresent(fields, "remote_user", string(m[3]))
+	if size, err := strconv.Atoi(string(m[7])); err == nil {
+		fields["bytes"] = size
+	}
+	setIfPresent(fields, "referer", string(m[8]))
+	setIfPresent(fields, "user_agent", string(m[9]))
+
+	level := "info"
+	switch {
+	case status >= 500:
+		level = "error"
+	case status >= 400:
+		level = "warn"
+	}
+
+	return LogEntry{
+		Timestamp: ts,
+		Level:     level,
+		Message:   string(m[5]),
+		Fields:    fields,
+	}, true
+}
+
+// ParseRFC5424Log parses a line in the syslog format described by RFC5424. The level is
+// derived from the severity of the priority value, and structured data elements are
+// retained as fields keyed by their SD-ID.
+func ParseRFC5424Log(line []byte) (LogEntry, bool) {
+	pri, rest, ok := parseSyslogPriority(string(line))
+	if !ok || !strings.HasPrefix(rest, "1 ") {
+		return LogEntry{}, false
+	}
+	rest = rest[2:]
+
+	// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+	header := make([]string, 5)
+	for i := range header {
+		end := strings.IndexByte(rest, ' ')
+		if end <= 0 {
+			return LogEntry{}, false
+		}
+		header[i], rest = rest[:end], rest[end+1:]
+	}
+
+	var entry LogEntry
+	if header[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, header[0])
+		if err != nil {
+			return LogEntry{}, false
+		}
+		entry.Timestamp = ts
+	}
+
+	fields := map[string]any{"facility": pri / 8}
+	for i, key := range []string{"hostname", "app_name", "procid", "msgid"} {
+		if header[i+1] != "-" {
+			fields[key] = header[i+1]
+		}
+	}
+
+	rest, ok = parseStructuredData(rest, fields)
+	if !ok {
+		return LogEntry{}, false
+	}
+
+	entry.Level = syslogLevel(pri)
+	entry.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	entry.Fields = fields
+	return entry, true
+}
+
+// parseStructuredData parses RFC5424 structured data at the start of s into fields,
+// returning the remainder of s.
+func parseStructuredData(s string, fields map[string]any) (string, bool) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], true
+	}
+	if !strings.HasPrefix(s, "[") {
+		return s, false
+	}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return s, false
+		}
+		id := s[:end]
+		s = s[end:]
+
+		params := make(map[string]any)
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return s, false
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return s, false
+			}
+			params[name] = value.String()
+		}
+		if !strings.HasPrefix(s, "]") {
+			return s, false
+		}
+		s = s[1:]
+		fields[id] = params
+	}
+	return s, true
+}
+
+// rfc3164Pattern matches the BSD syslog format described by RFC3164, with an optional
+// priority value.
+var rfc3164Pattern = regexp.MustCompile(
+	`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) ([^\s:\[]+)(?:\[([^\]]+)\])?: ?(.*)$`)
+
+// ParseRFC3164Log parses a line in the BSD syslog format described by RFC3164. The
+// priority value is optional, since it is commonly omitted in log files. Since RFC3164
+// timestamps include neither a year nor a time zone, UTC and the most recent year in
+// which the timestamp is not in the future are assumed - see RFC3164LogParser.
+func ParseRFC3164Log(line []byte) (LogEntry, bool) {
+	return parseRFC3164Log(line, time.Now())
+}
+
+// RFC3164LogParser returns a LogParser that is the same as ParseRFC3164Log, but infers
+// the year of timestamps relative to the time provided by clock instead of time.Now,
+// for example to make output deterministic in tests.
+func RFC3164LogParser(clock func() time.Time) LogParser {
+	return func(line []byte) (LogEntry, bool) {
+		return parseRFC3164Log(line, clock())
+	}
+}
+
+func parseRFC3164Log(line []byte, now time.Time) (LogEntry, bool) {
+	s := string(line)
+	pri, rest, hasPri := parseSyslogPriority(s)
+	if hasPri {
+		s = rest
+	}
+
+	m := rfc3164Pattern.FindStringSubmatch(s)
+	if m == nil {
+		return LogEntry{}, false
+	}
+	ts, err := parseSyslogTimestamp(m[1], now)
+	if err != nil {
+		return LogEntry{}, false
+	}
+
+	fields := map[string]any{
+		"hostname": m[2],
+		"app_name": m[3],
+	}
+	setIfPresent(fields, "procid", m[4])
+
+	entry := LogEntry{
+		Timestamp: ts,
+		Message:   m[5],
+		Fields:    fields,
+	}
+	if hasPri {
+		fields["facility"] = pri / 8
+		entry.Level = syslogLevel(pri)
+	}
+	return entry, true
+}
+
+// syslogFutureTolerance is how far in the future an RFC3164 timestamp may be, to allow
+// for clock skew, before it is assumed to be from the previous year.
+const syslogFutureTolerance = 24 * time.Hour
+
+// parseSyslogTimestamp parses an RFC3164 timestamp, which has neither a year nor a time
+// zone, assuming UTC and the most recent year around now in which the timestamp is not in
+// the future - for example, "Dec 31" read in January is from the previous year.
+func parseSyslogTimestamp(s string, now time.Time) (time.Time, error) {
+	ts, err := time.Parse(time.Stamp, s)
+	if err != nil {
+		return ts, err
+	}
+	now = now.UTC()
+	for year := now.Year() + 1; year > now.Year()-1; year-- {
+		if withYear := ts.AddDate(year, 0, 0); withYear.Sub(now) <= syslogFutureTolerance {
+			return withYear, nil
+		}
+	}
+	return ts.AddDate(now.Year()-1, 0, 0), nil
+}
+
+// parseSyslogPriority parses a "<PRI>" prefix from s.
+func parseSyslogPriority(s string) (pri int, rest string, ok bool) {
+	if !strings.HasPrefix(s, "<") {
+		return 0, s, false
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, s, false
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, s, false
+	}
+	return pri, s[end+1:], true
+}
+
+// syslogLevel maps the severity of a syslog priority value to a normalized level.
+func syslogLevel(pri int) string {
+	switch pri % 8 {
+	case 0, 1, 2:
+		return "fatal"
+	case 3:
+		return "error"
+	case 4:
+		return "warn"
+	case 5, 6:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// entryFromFields extracts common keys from structured fields into a LogEntry. Keys
+// that cannot be interpreted are retained in the entry's fields.
+func entryFromFields(fields map[string]any) LogEntry {
+	var entry LogEntry
+	for _, key := range timestampKeys {
+		if v, ok := fields[key]; ok {
+			if ts, ok := parseTimestamp(v); ok {
+				entry.Timestamp = ts
+				delete(fields, key)
+				break
+			}
+		}
+	}
+	for _, key := range levelKeys {
+		if v, ok := fields[key].(string); ok {
+			entry.Level = NormalizeLevel(v)
+			delete(fields, key)
+			break
+		}
+	}
+	for _, key := range messageKeys {
+		if v, ok := fields[key].(string); ok {
+			entry.Message = v
+			delete(fields, key)
+			break
+		}
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+	return entry
+}
+
+// parseTimestamp interprets v as a timestamp. Strings are parsed with timestampLayouts
+// or as numbers, and numbers are interpreted as Unix time in seconds, or milliseconds if
+// the value is too large to be seconds.
+func parseTimestamp(v any) (time.Time, bool) {
+	var unix float64
+	switch v := v.(type) {
+	case string:
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, v); err == nil {
+				return ts, true
+			}
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		unix = f
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		unix = f
+	case float64:
+		unix = v
+	default:
+		return time.Time{}, false
+	}
+
+	if unix <= 0 || math.IsInf(unix, 0) || math.IsNaN(unix) {
+		return time.Time{}, false
+	}
+	if unix > 1e12 {
+		unix /= 1000 // milliseconds
+	}
+	sec, frac := math.Modf(unix)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+}
+
+// setIfPresent sets key in fields if value is not empty or "-".
+func setIfPresent(fields map[string]any, key, value string) {
+	if value != "" && value != "-" {
+		fields[key] = value
+	}
+}
@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// LogEntry is the common schema that NormalizeLogs converts log lines into. It is
+// encoded as a JSON object with the keys "timestamp", "level", "message", and "fields",
+// where empty values are omitted.
+type LogEntry struct {
+	// Timestamp is the time the log entry was emitted, if known.
+	Timestamp time.Time
+	// Level is the normalized severity of the entry - see NormalizeLevel.
+	Level string
+	// Message is the human-readable message of the entry.
+	Message string
+	// Fields contains any additional structured data associated with the entry.
+	Fields map[string]any
+}
+
+var _ json.Marshaler = LogEntry{}
+
+// MarshalJSON encodes the entry in the common schema, formatting Timestamp as RFC3339
+// with nanoseconds.
+func (e LogEntry) MarshalJSON() ([]byte, error) {
+	var ts string
+	if !e.Timestamp.IsZero() {
+		ts = e.Timestamp.Format(time.RFC3339Nano)
+	}
+	return json.Marshal(struct {
+		Timestamp string         `json:"timestamp,omitempty"`
+		Level     string         `json:"level,omitempty"`
+		Message   string         `json:"message"`
+		Fields    map[string]any `json:"fields,omitempty"`
+	}{
+		Timestamp: ts,
+		Level:     e.Level,
+		Message:   e.Message,
+		Fields:    e.Fields,
+	})
+}
+
+// LogParser parses a line in a specific log format into a LogEntry. It should return
+// false if the line is not in the expected format.
+//
+// Implementations must not retain line.
+type LogParser func(line []byte) (LogEntry, bool)
+
+// LogFormat is a named LogParser that can be registered in LogFormats.
+type LogFormat struct {
+	// Name identifies the format, e.g. "logfmt".
+	Name string
+	// Parse attempts to parse a line in this format.
+	Parse LogParser
+}
+
+// LogFormats is a registry of LogFormat implementations used to detect the format of a
+// line. Formats are tried in order, and the first format to successfully parse a line
+// is used, so more specific formats should be registered before more lenient ones.
+//
+// To add custom formats, use Register, or append to the LogFormats returned by
+// DefaultLogFormats.
+type LogFormats []LogFormat
+
+// DefaultLogFormats returns a new registry of the built-in log formats: JSON, syslog
+// (RFC5424 and RFC3164), Apache/nginx combined logs, and logfmt.
+func DefaultLogFormats() LogFormats {
+	return LogFormats{
+		{Name: "json", Parse: ParseJSONLog},
+		{Name: "syslog-rfc5424", Parse: ParseRFC5424Log},
+		{Name: "syslog-rfc3164", Parse: ParseRFC3164Log},
+		{Name: "combined", Parse: ParseCombinedLog},
+		{Name: "logfmt", Parse: ParseLogfmtLog},
+	}
+}
+
+// Register adds a format to the end of the registry. To give a format precedence over
+// existing formats, construct LogFormats directly instead.
+func (formats *LogFormats) Register(format LogFormat) {
+	*formats = append(*formats, format)
+}
+
+// Detect parses line with the first matching format in the registry, returning the name
+// of the format used. If no format matches, ok is false.
+func (formats LogFormats) Detect(line []byte) (format string, entry LogEntry, ok bool) {
+	for _, f := range formats {
+		if entry, ok := f.Parse(line); ok {
+			return f.Name, entry, true
+		}
+	}
+	return "", LogEntry{}, false
+}
+
+// NormalizeLogs is a Pipeline that detects the format of each line using the given
+// registry and normalizes it into a JSON-encoded LogEntry, which makes the output
+// suitable for further processing with e.g. jq.Pipeline. If formats is nil,
+// DefaultLogFormats is used.
+//
+// Lines that do not match any format are retained as a LogEntry with only Message set to
+// the contents of the line. Empty lines are retained as-is.
+func NormalizeLogs(formats LogFormats) Pipeline {
+	if formats == nil {
+		formats = DefaultLogFormats()
+	}
+	return MapErr(func(line []byte) ([]byte, error) {
+		if len(line) == 0 {
+			return line, nil
+		}
+		_, entry, ok := formats.Detect(line)
+		if !ok {
+			entry = LogEntry{Message: string(line)}
+		}
+		return json.Marshal(entry)
+	})
+}
+
+// NormalizeLevel maps common severity names onto the set of levels "trace", "debug",
+// "info", "warn", "error", and "fatal". Unrecognized levels are returned in lowercase.
+func NormalizeLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case "trace", "trce", "trc":
+		return "trace"
+	case "debug", "dbug", "dbg":
+		return "debug"
+	case "info", "inf", "information", "informational", "notice":
+		return "info"
+	case "warn", "wrn", "warning":
+		return "warn"
+	case "error", "err", "eror":
+		return "error"
+	case "fatal", "crit", "critical", "alert", "emerg", "emergency", "panic":
+		return "fatal"
+	default:
+		return level
+	}
+}
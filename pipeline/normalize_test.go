@@ -0,0 +1,177 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/jq"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+func TestNormalizeLogs(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		line       string
+		wantFormat string
+		want       autogold.Value
+	}{
+		{
+			name:       "json",
+			line:       `{"ts":1700000000.5,"level":"WARNING","msg":"disk almost full","disk":"/dev/sda1","used":0.93}`,
+			wantFormat: "json",
+			want:       autogold.Expect(`{"timestamp":"2023-11-14T22:13:20.5Z","level":"warn","message":"disk almost full","fields":{"disk":"/dev/sda1","used":0.93}}`),
+		},
+		{
+			name:       "logfmt",
+			line:       `time=2023-11-14T22:13:20Z level=info msg="request served" path=/healthz duration=3ms`,
+			wantFormat: "logfmt",
+			want:       autogold.Expect(`{"timestamp":"2023-11-14T22:13:20Z","level":"info","message":"request served","fields":{"duration":"3ms","path":"/healthz"}}`),
+		},
+		{
+			name:       "combined",
+			line:       `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 404 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			wantFormat: "combined",
+			want:       autogold.Expect(`{"timestamp":"2000-10-10T13:55:36-07:00","level":"warn","message":"GET /apache_pb.gif HTTP/1.0","fields":{"bytes":2326,"referer":"http://www.example.com/start.html","remote_addr":"127.0.0.1","remote_user":"frank","status":404,"user_agent":"Mozilla/4.08"}}`),
+		},
+		{
+			name:       "common",
+			line:       `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "POST /api HTTP/1.1" 502 -`,
+			wantFormat: "combined",
+			want:       autogold.Expect(`{"timestamp":"2000-10-10T13:55:36Z","level":"error","message":"POST /api HTTP/1.1","fields":{"remote_addr":"10.0.0.1","status":502}}`),
+		},
+		{
+			name:       "rfc5424",
+			line:       `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`,
+			wantFormat: "syslog-rfc5424",
+			want:       autogold.Expect(`{"timestamp":"2003-10-11T22:14:15.003Z","level":"info","message":"An application event","fields":{"app_name":"evntslog","exampleSDID@32473":{"eventSource":"Application","iut":"3"},"facility":20,"hostname":"mymachine.example.com","msgid":"ID47"}}`),
+		},
+		{
+			name:       "rfc5424 without structured data",
+			line:       `<11>1 - host app 1234 - - something broke`,
+			wantFormat: "syslog-rfc5424",
+			want:       autogold.Expect(`{"level":"error","message":"something broke","fields":{"app_name":"app","facility":1,"hostname":"host","procid":"1234"}}`),
+		},
+		{
+			name:       "unrecognized",
+			line:       `Compiling streamline v0.1.0...`,
+			wantFormat: "",
+			want:       autogold.Expect(`{"message":"Compiling streamline v0.1.0..."}`),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			format, _, _ := pipeline.DefaultLogFormats().Detect([]byte(tc.line))
+			assert.Equal(t, tc.wantFormat, format)
+
+			line, err := pipeline.NormalizeLogs(nil).ProcessLine([]byte(tc.line))
+			require.NoError(t, err)
+			tc.want.Equal(t, string(line))
+		})
+	}
+
+	t.Run("rfc3164", func(t *testing.T) {
+		t.Parallel()
+
+		parse := pipeline.RFC3164LogParser(func() time.Time {
+			return time.Date(2022, time.November, 1, 0, 0, 0, 0, time.UTC)
+		})
+		entry, ok := parse([]byte(`<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8`))
+		require.True(t, ok)
+		assert.Equal(t, time.Date(2022, time.October, 11, 22, 14, 15, 0, time.UTC), entry.Timestamp)
+		assert.Equal(t, "fatal", entry.Level)
+		assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", entry.Message)
+		autogold.Expect(map[string]interface{}{
+			"app_name": "su", "facility": 4, "hostname": "mymachine",
+			"procid": "230",
+		}).Equal(t, entry.Fields)
+	})
+
+	t.Run("rfc3164 year", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tc := range []struct {
+			now  time.Time
+			line string
+			want time.Time
+		}{
+			{
+				now:  time.Date(2023, time.January, 1, 0, 0, 10, 0, time.UTC),
+				line: "Dec 31 23:59:59 host app: late",
+				want: time.Date(2022, time.December, 31, 23, 59, 59, 0, time.UTC),
+			},
+			{
+				now:  time.Date(2022, time.December, 31, 23, 59, 50, 0, time.UTC),
+				line: "Jan  1 00:00:01 host app: clock skew",
+				want: time.Date(2023, time.January, 1, 0, 0, 1, 0, time.UTC),
+			},
+			{
+				now:  time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC),
+				line: "Jun  1 12:00:00 host app: later today",
+				want: time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC),
+			},
+		} {
+			entry, ok := pipeline.RFC3164LogParser(func() time.Time { return tc.now })([]byte(tc.line))
+			require.True(t, ok, tc.line)
+			assert.Equal(t, tc.want, entry.Timestamp, tc.line)
+		}
+	})
+
+	t.Run("empty line", func(t *testing.T) {
+		t.Parallel()
+
+		line, err := pipeline.NormalizeLogs(nil).ProcessLine([]byte{})
+		assert.NoError(t, err)
+		assert.NotNil(t, line)
+		assert.Empty(t, line)
+	})
+
+	t.Run("custom format", func(t *testing.T) {
+		t.Parallel()
+
+		formats := pipeline.LogFormats{{
+			Name: "bracketed",
+			Parse: func(line []byte) (pipeline.LogEntry, bool) {
+				level, msg, ok := strings.Cut(string(line), "] ")
+				if !ok || !strings.HasPrefix(level, "[") {
+					return pipeline.LogEntry{}, false
+				}
+				return pipeline.LogEntry{
+					Level:   pipeline.NormalizeLevel(level[1:]),
+					Message: msg,
+				}, true
+			},
+		}}
+		formats = append(formats, pipeline.DefaultLogFormats()...)
+		formats.Register(pipeline.LogFormat{
+			Name:  "never",
+			Parse: func([]byte) (pipeline.LogEntry, bool) { return pipeline.LogEntry{}, false },
+		})
+
+		lines, err := streamline.New(strings.NewReader("[ERR] oh no\nlevel=debug msg=hi")).
+			WithPipeline(pipeline.NormalizeLogs(formats)).
+			WithPipeline(jq.Pipeline(`.level + ": " + .message`)).
+			Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{`"error: oh no"`, `"debug: hi"`}).Equal(t, lines)
+	})
+}
+
+func TestNormalizeLevel(t *testing.T) {
+	for input, want := range map[string]string{
+		"WARNING": "warn",
+		"Err":     "error",
+		"crit":    "fatal",
+		"notice":  "info",
+		" DBG ":   "debug",
+		"Verbose": "verbose",
+	} {
+		assert.Equal(t, want, pipeline.NormalizeLevel(input), input)
+	}
+}
@@ -1,5 +1,7 @@
 package pipeline
 
+import "bytes"
+
 // Pipeline implementations are used to transform the data provided to a streamline.Stream.
 // For example, they are useful for mapping and pruning data. To configure a Stream to use
 // a Pipeline, use (*Stream).WithPipeline(...).
@@ -14,10 +16,20 @@ type Pipeline interface {
 	ProcessLine(line []byte) ([]byte, error)
 }
 
+// Flusher can be implemented by Pipelines that buffer or aggregate lines, to emit output
+// when the end of the stream is reached. streamline.Stream calls Flush on its pipelines
+// once the input is exhausted.
+type Flusher interface {
+	// Flush returns any remaining output, with multiple lines separated by the line
+	// separator of the Stream, or nil if there is no remaining output.
+	Flush() ([]byte, error)
+}
+
 // MultiPipeline is a Pipeline that applies all its Pipelines in serial.
 type MultiPipeline []Pipeline
 
 var _ Pipeline = (MultiPipeline)(nil)
+var _ Flusher = (MultiPipeline)(nil)
 
 // ProcessLine will provide the line to all active pipelines in the MultiPipeline in
 // serial, passing the result of each pipeline to the next. If any pipeline indicates a
@@ -38,3 +50,66 @@ func (mp MultiPipeline) ProcessLine(line []byte) ([]byte, error) {
 	}
 	return line, err
 }
+
+// Flush flushes each pipeline that implements Flusher in serial. The output of each
+// flushed pipeline is passed line by line to the pipelines after it, which are flushed
+// afterwards. Lines in the returned output are separated by '\n' - use FlushLines for
+// streams with a different line separator.
+func (mp MultiPipeline) Flush() ([]byte, error) {
+	var output []byte
+	var lines int
+	err := mp.FlushLines('\n', func(line []byte) error {
+		if lines > 0 {
+			output = append(output, '\n')
+		}
+		output = append(output, line...)
+		lines++
+		return nil
+	})
+	if lines > 0 && output == nil {
+		// Retain a single empty line.
+		output = []byte{}
+	}
+	return output, err
+}
+
+// FlushLines is the same as Flush, but splits the output of each Flusher on separator,
+// and calls handle with each resulting line instead of returning them.
+func (mp MultiPipeline) FlushLines(separator byte, handle func(line []byte) error) error {
+	for i, p := range mp {
+		next := mp[i+1:]
+		handleFlushed := func(line []byte) error {
+			line, err := next.ProcessLine(line)
+			if err != nil || line == nil {
+				return err
+			}
+			return handle(line)
+		}
+
+		// Nested MultiPipelines must split output on the same separator.
+		if nested, ok := p.(MultiPipeline); ok {
+			if err := nested.FlushLines(separator, handleFlushed); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, ok := p.(Flusher)
+		if !ok {
+			continue
+		}
+		flushed, err := f.Flush()
+		if err != nil {
+			return err
+		}
+		if flushed == nil {
+			continue
+		}
+		for _, line := range bytes.Split(flushed, []byte{separator}) {
+			if err := handleFlushed(line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
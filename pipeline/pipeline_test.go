@@ -89,3 +89,56 @@ func TestMultiPipeline(t *testing.T) {
 		assert.False(t, map2called)
 	})
 }
+
+func TestMultiPipelineFlush(t *testing.T) {
+	t.Run("no flushers", func(t *testing.T) {
+		t.Parallel()
+
+		p := MultiPipeline{Map(func(line []byte) []byte { return line })}
+		output, err := p.Flush()
+		assert.NoError(t, err)
+		assert.Nil(t, output)
+	})
+
+	t.Run("flushed lines are processed by subsequent pipelines", func(t *testing.T) {
+		t.Parallel()
+
+		p := MultiPipeline{
+			ReassembleJSON(ReassembleJSONOptions{}),
+			Filter(func(line []byte) bool { return len(line) > 1 }),
+			Map(func(line []byte) []byte { return append([]byte("> "), line...) }),
+		}
+
+		line, err := p.ProcessLine([]byte("{"))
+		assert.NoError(t, err)
+		assert.Nil(t, line)
+		line, err = p.ProcessLine([]byte(`  "a": 1`))
+		assert.NoError(t, err)
+		assert.Nil(t, line)
+
+		output, err := p.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, `>   "a": 1`, string(output))
+	})
+
+	t.Run("FlushLines with nested pipelines", func(t *testing.T) {
+		t.Parallel()
+
+		p := MultiPipeline{
+			MultiPipeline{ReassembleJSON(ReassembleJSONOptions{})},
+			Map(func(line []byte) []byte { return append([]byte("> "), line...) }),
+		}
+		_, err := p.ProcessLine([]byte("{"))
+		assert.NoError(t, err)
+		_, err = p.ProcessLine([]byte(`  "a": 1`))
+		assert.NoError(t, err)
+
+		var lines []string
+		err = p.FlushLines('\n', func(line []byte) error {
+			lines = append(lines, string(line))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"> {", `>   "a": 1`}, lines)
+	})
+}
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// ReassembleJSONOptions configures ReassembleJSON.
+type ReassembleJSONOptions struct {
+	// MaxLines is the maximum number of lines to buffer for a single value. If a value
+	// spans more lines, the buffered lines are emitted unmodified. The default is 1000.
+	MaxLines int
+}
+
+// ReassembleJSON is a Pipeline that reassembles JSON objects and arrays that are spread
+// across multiple lines, such as pretty-printed JSON, into single lines. This allows
+// pipelines that operate on a line at a time, such as jq.Pipeline, to process
+// pretty-printed JSON.
+//
+// Lines that start with '{' or '[' followed by valid JSON are buffered until the matching
+// closing bracket is found, tracking nesting depth and skipping brackets in strings.
+// Each complete value is emitted as a single line of compact JSON. Other lines, and
+// buffered lines that do not form a valid JSON value, are emitted unmodified.
+//
+// ReassembleJSON must be used with the default '\n' line separator. If the stream ends
+// while a value is incomplete, the buffered lines are emitted unmodified.
+func ReassembleJSON(opts ReassembleJSONOptions) Pipeline {
+	if opts.MaxLines <= 0 {
+		opts.MaxLines = 1000
+	}
+	return &reassembleJSONPipeline{maxLines: opts.MaxLines}
+}
+
+type reassembleJSONPipeline struct {
+	maxLines int
+
+	// buffer holds the lines of the value being reassembled, separated by newlines.
+	buffer bytes.Buffer
+	// lines is the number of lines in buffer.
+	lines int
+	// scan is the state of the scan of the value being reassembled.
+	scan jsonScanState
+
+	// output holds the lines to emit.
+	output bytes.Buffer
+}
+
+// jsonScanState tracks the nesting depth of a JSON value.
+type jsonScanState struct {
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+// scan advances the state over data, returning the index in data after the end of the
+// value, or -1 if the value is not complete.
+func (s *jsonScanState) scan(data []byte) int {
+	for i, b := range data {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case s.inString:
+			switch b {
+			case '\\':
+				s.escaped = true
+			case '"':
+				s.inString = false
+			}
+		case b == '"':
+			s.inString = true
+		case b == '{' || b == '[':
+			s.depth++
+		case b == '}' || b == ']':
+			s.depth--
+			if s.depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+func (p *reassembleJSONPipeline) ProcessLine(line []byte) ([]byte, error) {
+	p.output.Reset()
+	if !p.process(line) {
+		return nil, nil
+	}
+	return p.output.Bytes(), nil
+}
+
+// process handles line, returning false if nothing was written to output.
+func (p *reassembleJSONPipeline) process(line []byte) bool {
+	if p.lines == 0 {
+		trimmed := bytes.TrimLeft(line, " \t\r")
+		if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+			p.emit(line)
+			return true
+		}
+
+		// Fast path for values that start and end on this line.
+		p.scan = jsonScanState{}
+		if end := p.scan.scan(line); end >= 0 {
+			if !isSpace(line[end:]) || !p.emitCompact(line[:end]) {
+				p.emit(line)
+			}
+			return true
+		}
+
+		// Lines that merely start with a bracket, such as "[INFO] starting", should not
+		// hold back output until MaxLines is reached.
+		if !isJSONPrefix(line) {
+			p.emit(line)
+			return true
+		}
+
+		p.buffer.Reset()
+		p.buffer.Write(line)
+		p.lines = 1
+		return false
+	}
+
+	end := p.scan.scan(line)
+	if end < 0 {
+		p.buffer.WriteByte('\n')
+		p.buffer.Write(line)
+		p.lines++
+		if p.lines >= p.maxLines {
+			p.flush()
+			return true
+		}
+		return false
+	}
+
+	// The value is complete - check that it is valid JSON before emitting it.
+	valueLen := p.buffer.Len() + 1 + end
+	p.buffer.WriteByte('\n')
+	p.buffer.Write(line)
+	if !p.emitCompact(p.buffer.Bytes()[:valueLen]) {
+		p.flush()
+		return true
+	}
+	p.lines = 0
+
+	// Process anything after the value as a new line.
+	if rest := line[end:]; !isSpace(rest) {
+		p.output.WriteByte('\n')
+		if !p.process(rest) {
+			// Remove the trailing newline.
+			p.output.Truncate(p.output.Len() - 1)
+		}
+	}
+	return true
+}
+
+// Flush emits the lines of an incomplete value unmodified.
+func (p *reassembleJSONPipeline) Flush() ([]byte, error) {
+	if p.lines == 0 {
+		return nil, nil
+	}
+	p.output.Reset()
+	p.flush()
+	return p.output.Bytes(), nil
+}
+
+// emit writes line to the output.
+func (p *reassembleJSONPipeline) emit(line []byte) {
+	p.output.Write(line)
+}
+
+// emitCompact writes value to the output as compact JSON, returning false if value is
+// not valid JSON.
+func (p *reassembleJSONPipeline) emitCompact(value []byte) bool {
+	n := p.output.Len()
+	if err := json.Compact(&p.output, value); err != nil {
+		p.output.Truncate(n)
+		return false
+	}
+	return true
+}
+
+// flush writes all buffered lines to the output unmodified.
+func (p *reassembleJSONPipeline) flush() {
+	p.output.Write(p.buffer.Bytes())
+	p.buffer.Reset()
+	p.lines = 0
+}
+
+// isJSONPrefix reports whether data is the start of a valid JSON value.
+func isJSONPrefix(data []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := dec.Token(); err != nil {
+			return err == io.EOF || err == io.ErrUnexpectedEOF
+		}
+	}
+}
+
+func isSpace(data []byte) bool {
+	return len(bytes.TrimSpace(data)) == 0
+}
@@ -0,0 +1,150 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/jq"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+func TestReassembleJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+		opts  pipeline.ReassembleJSONOptions
+		want  autogold.Value
+	}{
+		{
+			name: "pretty-printed values mixed with noise",
+			input: `Loading...
+{
+	"message": "hello",
+	"tags": ["a", "b"]
+}
+Still loading...
+[
+  1,
+  2
+]
+{"single": "line"}`,
+			want: autogold.Expect([]string{
+				"Loading...", `{"message":"hello","tags":["a","b"]}`, "Still loading...", "[1,2]",
+				`{"single":"line"}`,
+			}),
+		},
+		{
+			name: "brackets and escapes in strings",
+			input: `{
+  "msg": "unbalanced } ] { [",
+  "quoted": "say \"}\" \\",
+  "nested": {"a": [{"b": "\\\""}]}
+}`,
+			want: autogold.Expect([]string{`{"msg":"unbalanced } ] { [","quoted":"say \"}\" \\","nested":{"a":[{"b":"\\\""}]}}`}),
+		},
+		{
+			name: "text after value",
+			input: `{
+  "a": 1
+} done
+{"b": 2} trailing`,
+			want: autogold.Expect([]string{`{"a":1}`, " done", `{"b": 2} trailing`}),
+		},
+		{
+			name: "consecutive values",
+			input: `{
+  "a": 1
+}{
+  "b": 2
+}`,
+			want: autogold.Expect([]string{`{"a":1}`, `{"b":2}`}),
+		},
+		{
+			name: "invalid JSON",
+			input: `[INFO] starting
+[WARN
+  retrying
+] done
+{
+  "a": not json
+}`,
+			want: autogold.Expect([]string{
+				"[INFO] starting", "[WARN", "  retrying", "] done",
+				"{",
+				`  "a": not json`,
+				"}",
+			}),
+		},
+		{
+			name: "max lines",
+			input: `[
+  1,
+  2,
+  3
+]
+[
+  4
+]`,
+			opts: pipeline.ReassembleJSONOptions{MaxLines: 3},
+			want: autogold.Expect([]string{"[", "  1,", "  2,", "  3", "]", "[4]"}),
+		},
+		{
+			name: "incomplete value",
+			input: `before
+{
+  "a": 1`,
+			want: autogold.Expect([]string{"before", "{", `  "a": 1`}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			lines, err := streamline.New(strings.NewReader(tc.input)).
+				WithPipeline(pipeline.ReassembleJSON(tc.opts)).
+				Lines()
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+
+	t.Run("lines that cannot start a value are not held back", func(t *testing.T) {
+		t.Parallel()
+
+		p := pipeline.ReassembleJSON(pipeline.ReassembleJSONOptions{})
+		for _, line := range []string{"[INFO] starting", "[2024-01-01] ready", "{foo}"} {
+			out, err := p.ProcessLine([]byte(line))
+			require.NoError(t, err)
+			assert.Equal(t, line, string(out))
+		}
+
+		// The start of a value is still buffered.
+		out, err := p.ProcessLine([]byte("["))
+		require.NoError(t, err)
+		assert.Nil(t, out)
+	})
+
+	t.Run("with jq", func(t *testing.T) {
+		t.Parallel()
+
+		lines, err := streamline.New(strings.NewReader(`Loading...
+Still loading...
+{
+	"message": "this is the real data!"
+}
+{
+	"message": "and more"
+}`)).
+			WithPipeline(pipeline.MultiPipeline{
+				pipeline.ReassembleJSON(pipeline.ReassembleJSONOptions{}),
+				jq.Pipeline(".message", jq.WithNonJSON(pipeline.NonJSONSkip)),
+			}).
+			Lines()
+		require.NoError(t, err)
+		assert.Equal(t, []string{`"this is the real data!"`, `"and more"`}, lines)
+	})
+}
@@ -0,0 +1,326 @@
+package pipeline
+
+import (
+	"bytes"
+	"net/netip"
+	"regexp"
+	"sort"
+
+	"go.bobheadxi.dev/streamline/internal/ahocorasick"
+)
+
+// Detector finds sensitive data to redact in a line. If Pattern has capture groups, only
+// the first capture group of each match is redacted - otherwise the entire match is
+// redacted.
+type Detector struct {
+	// Name identifies the kind of data detected, e.g. "email". It is provided to
+	// RedactMask implementations.
+	Name string
+	// Pattern matches candidate data to redact.
+	Pattern *regexp.Regexp
+	// Validate, if set, is used to check each candidate before it is redacted, for
+	// example to perform checksum validation.
+	Validate func(match []byte) bool
+	// Prefilter, if set, is a cheap check for whether a line may contain data matched by
+	// Pattern. Pattern is only applied to lines for which Prefilter returns true.
+	Prefilter func(line []byte) bool
+}
+
+// Built-in detectors for commonly leaked secrets and personally identifiable information.
+// DefaultDetectors returns all of them.
+var (
+	DetectAWSAccessKeys = Detector{
+		Name:    "aws_access_key",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[A-Z0-9]{16}\b`),
+		Prefilter: func(line []byte) bool {
+			return containsAny(line, "AKIA", "ASIA", "AGPA", "AIDA", "AROA", "AIPA", "ANPA", "ANVA")
+		},
+	}
+	DetectAWSSecretKeys = Detector{
+		Name:      "aws_secret_key",
+		Pattern:   regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+		Prefilter: func(line []byte) bool { return containsFold(line, "secret") },
+	}
+	DetectGitHubTokens = Detector{
+		Name:    "github_token",
+		Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+		Prefilter: func(line []byte) bool {
+			return containsAny(line, "ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_")
+		},
+	}
+	DetectJWTs = Detector{
+		Name:      "jwt",
+		Pattern:   regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		Prefilter: func(line []byte) bool { return bytes.Contains(line, []byte("eyJ")) },
+	}
+	DetectBearerTokens = Detector{
+		Name:      "bearer_token",
+		Pattern:   regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+		Prefilter: func(line []byte) bool { return containsFold(line, "bearer") },
+	}
+	DetectEmails = Detector{
+		Name:      "email",
+		Pattern:   regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+		Prefilter: func(line []byte) bool { return bytes.IndexByte(line, '@') >= 0 },
+	}
+	DetectIPAddresses = Detector{
+		Name:    "ip_address",
+		Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{1,4}\b`),
+		Validate: func(match []byte) bool {
+			_, err := netip.ParseAddr(string(match))
+			return err == nil
+		},
+		Prefilter: func(line []byte) bool {
+			// IPv4 addresses have a digit before a '.', and IPv6 addresses have at least
+			// two ':'.
+			for i := bytes.IndexByte(line, '.'); i > 0; {
+				if isDigit(line[i-1]) {
+					return true
+				}
+				next := bytes.IndexByte(line[i+1:], '.')
+				if next < 0 {
+					break
+				}
+				i += next + 1
+			}
+			return bytes.Count(line, []byte{':'}) >= 2
+		},
+	}
+	// DetectCreditCards only redacts numbers with the prefix and length of a major card
+	// network that pass the Luhn checksum, to avoid redacting other long numbers such as
+	// timestamps.
+	DetectCreditCards = Detector{
+		Name:     "credit_card",
+		Pattern:  regexp.MustCompile(`\b[2-6](?:[ -]?\d){12,18}\b`),
+		Validate: func(match []byte) bool { return cardPrefixValid(match) && luhnValid(match) },
+		Prefilter: func(line []byte) bool {
+			var digits int
+			for _, c := range line {
+				if isDigit(c) {
+					if digits++; digits >= 13 {
+						return true
+					}
+				}
+			}
+			return false
+		},
+	}
+)
+
+// DefaultDetectors returns all built-in detectors.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		DetectAWSAccessKeys,
+		DetectAWSSecretKeys,
+		DetectGitHubTokens,
+		DetectJWTs,
+		DetectBearerTokens,
+		DetectEmails,
+		DetectIPAddresses,
+		DetectCreditCards,
+	}
+}
+
+// RedactMask generates the replacement for redacted data. kind is the Name of the
+// Detector that found the data, "secret" for literal secrets, or "pattern" for custom
+// patterns.
+type RedactMask func(kind string, match []byte) []byte
+
+// FixedMask replaces all redacted data with mask.
+func FixedMask(mask string) RedactMask {
+	return func(string, []byte) []byte { return []byte(mask) }
+}
+
+// KindMask replaces redacted data with "[REDACTED:<kind>]".
+func KindMask() RedactMask {
+	return func(kind string, _ []byte) []byte { return []byte("[REDACTED:" + kind + "]") }
+}
+
+// RedactOptions configures Redact.
+type RedactOptions struct {
+	// Detectors to apply. If nil, DefaultDetectors is used - to disable all detectors,
+	// provide an empty slice.
+	Detectors []Detector
+	// Secrets are literal values to redact. Secrets are matched with the Aho-Corasick
+	// algorithm, so performance scales well with many secrets.
+	Secrets []string
+	// Patterns are custom regular expressions to redact.
+	Patterns []*regexp.Regexp
+	// Mask generates replacements for redacted data. If nil, FixedMask("[REDACTED]") is
+	// used.
+	Mask RedactMask
+}
+
+// Redact is a Pipeline that replaces sensitive data in each line, as configured by
+// opts. Overlapping matches are merged and replaced with a single mask, attributed to
+// the earliest match.
+func Redact(opts RedactOptions) Pipeline {
+	r := &redactor{
+		detectors: opts.Detectors,
+		secrets:   ahocorasick.New(opts.Secrets),
+		mask:      opts.Mask,
+	}
+	if r.detectors == nil {
+		r.detectors = DefaultDetectors()
+	}
+	for _, p := range opts.Patterns {
+		r.detectors = append(r.detectors, Detector{Name: "pattern", Pattern: p})
+	}
+	if r.mask == nil {
+		r.mask = FixedMask("[REDACTED]")
+	}
+	return MapErr(r.redact)
+}
+
+type redactor struct {
+	detectors []Detector
+	secrets   *ahocorasick.Matcher
+	mask      RedactMask
+}
+
+type redaction struct {
+	start, end int
+	kind       string
+}
+
+func (r *redactor) redact(line []byte) ([]byte, error) {
+	var found []redaction
+	for _, m := range r.secrets.FindAll(line) {
+		found = append(found, redaction{start: m.Start, end: m.End, kind: "secret"})
+	}
+	for _, d := range r.detectors {
+		if d.Prefilter != nil && !d.Prefilter(line) {
+			continue
+		}
+		for _, loc := range d.Pattern.FindAllSubmatchIndex(line, -1) {
+			start, end := loc[0], loc[1]
+			// Only redact the first capture group, if there is one.
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if d.Validate != nil && !d.Validate(line[start:end]) {
+				continue
+			}
+			found = append(found, redaction{start: start, end: end, kind: d.Name})
+		}
+	}
+	if len(found) == 0 {
+		return line, nil
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].start < found[j].start })
+
+	var out bytes.Buffer
+	out.Grow(len(line))
+	var written int
+	for i := 0; i < len(found); {
+		current := found[i]
+		// Merge all redactions that overlap with the current one.
+		for i++; i < len(found) && found[i].start < current.end; i++ {
+			if found[i].end > current.end {
+				current.end = found[i].end
+			}
+		}
+		out.Write(line[written:current.start])
+		out.Write(r.mask(current.kind, line[current.start:current.end]))
+		written = current.end
+	}
+	out.Write(line[written:])
+	return out.Bytes(), nil
+}
+
+// luhnValid checks that the digits in number, ignoring spaces and dashes, pass the Luhn
+// checksum used by credit card numbers.
+func luhnValid(number []byte) bool {
+	var sum, digits int
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
+
+// cardPrefixValid checks that the digits in number, ignoring spaces and dashes, have the
+// issuer prefix and length of a major card network.
+func cardPrefixValid(number []byte) bool {
+	digits := make([]byte, 0, len(number))
+	for _, c := range number {
+		if isDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	n := len(digits)
+	prefix := func(length int) int {
+		var p int
+		for _, c := range digits[:length] {
+			p = p*10 + int(c-'0')
+		}
+		return p
+	}
+	switch {
+	case digits[0] == '4': // Visa
+		return n == 13 || n == 16 || n == 19
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720: // Mastercard
+		return n == 16
+	case prefix(2) == 34 || prefix(2) == 37: // American Express
+		return n == 15
+	case prefix(3) >= 300 && prefix(3) <= 305, prefix(2) == 36, prefix(2) == 38, prefix(2) == 39: // Diners Club
+		return n >= 14 && n <= 19
+	case prefix(4) >= 3528 && prefix(4) <= 3589: // JCB
+		return n >= 16 && n <= 19
+	case prefix(4) == 6011, prefix(3) >= 644 && prefix(3) <= 649, prefix(2) == 65, // Discover
+		prefix(2) == 62: // UnionPay
+		return n >= 16 && n <= 19
+	default:
+		return false
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func containsAny(line []byte, substrs ...string) bool {
+	for _, s := range substrs {
+		if bytes.Contains(line, []byte(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether line contains substr, ignoring ASCII case. substr must be
+// lowercase.
+func containsFold(line []byte, substr string) bool {
+	for i := 0; i+len(substr) <= len(line); i++ {
+		match := true
+		for j := 0; j < len(substr); j++ {
+			c := line[i+j]
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != substr[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,434 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+)
+
+// NonJSONPolicy indicates how Pipelines that operate on JSON data should handle lines
+// that are not valid JSON.
+type NonJSONPolicy int
+
+const (
+	// NonJSONPassthrough retains lines that are not valid JSON unmodified. It is the
+	// default policy.
+	NonJSONPassthrough NonJSONPolicy = iota
+	// NonJSONSkip omits lines that are not valid JSON.
+	NonJSONSkip
+	// NonJSONError returns an error on lines that are not valid JSON.
+	NonJSONError
+	// NonJSONWrap wraps lines that are not valid JSON in an object, {"raw": "..."}, and
+	// processes the object instead.
+	NonJSONWrap
+)
+
+// WrapNonJSON returns the object used by NonJSONWrap for line.
+func WrapNonJSON(line []byte) map[string]any {
+	return map[string]any{"raw": string(line)}
+}
+
+// TemplateOptions configures Template.
+type TemplateOptions struct {
+	// NonJSON configures how lines that are not valid JSON are handled. The default is
+	// NonJSONPassthrough.
+	NonJSON NonJSONPolicy
+	// Funcs are additional functions to make available to the template. They take
+	// precedence over the built-in TemplateFuncs.
+	Funcs template.FuncMap
+	// NoColor disables the ANSI escape codes generated by the "color" and "colorLevel"
+	// template functions.
+	NoColor bool
+}
+
+// Template is a Pipeline that parses each line as a JSON object and renders it with a
+// text/template template, which is useful for converting JSON lines into human-readable
+// text. Numbers are decoded as json.Number to preserve their original formatting.
+// Missing fields, including fields of missing or null objects such as {{.a.b}} on a line
+// without "a", render as an empty string.
+//
+// In addition to the standard text/template functions, the functions in TemplateFuncs
+// are available. Lines that are not JSON objects, including other JSON values such as
+// numbers and strings, are handled according to TemplateOptions.NonJSON. Empty lines are
+// retained as-is.
+//
+// If the template fails to parse, Template will return a pipeline that returns an error
+// immediately on read - to handle template errors, use BuildTemplate instead.
+func Template(text string, opts TemplateOptions) Pipeline {
+	p, err := BuildTemplate(text, opts)
+	if err != nil {
+		return MapErr(func(line []byte) ([]byte, error) { return nil, err })
+	}
+	return p
+}
+
+// BuildTemplate safely builds a Template pipeline, returning an error if the template
+// fails to parse.
+func BuildTemplate(text string, opts TemplateOptions) (Pipeline, error) {
+	funcs := TemplateFuncs(!opts.NoColor)
+	for name, fn := range opts.Funcs {
+		funcs[name] = fn
+	}
+	funcs[noValueFunc] = noValue
+	funcs[fieldFunc] = field
+	tmpl, err := template.New("line").Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			safeFieldAccess(t.Tree, t.Tree.Root)
+			renderNoValue(t.Tree, t.Tree.Root)
+		}
+	}
+	return &templatePipeline{
+		tmpl:    tmpl,
+		nonJSON: opts.NonJSON,
+	}, nil
+}
+
+type templatePipeline struct {
+	tmpl    *template.Template
+	nonJSON NonJSONPolicy
+	buffer  bytes.Buffer
+}
+
+func (p *templatePipeline) ProcessLine(line []byte) ([]byte, error) {
+	if len(line) == 0 {
+		return line, nil
+	}
+
+	var data any
+	if object, err := decodeObject(line); err != nil {
+		switch p.nonJSON {
+		case NonJSONSkip:
+			return nil, nil
+		case NonJSONError:
+			return nil, fmt.Errorf("json: %w: %s", err, string(line))
+		case NonJSONWrap:
+			data = WrapNonJSON(line)
+		default:
+			return line, nil
+		}
+	} else {
+		data = object
+	}
+
+	// Reset buffer - by the time a new line is processed, nobody should be holding a
+	// reference to the previous results.
+	p.buffer.Reset()
+	if err := p.tmpl.Execute(&p.buffer, data); err != nil {
+		return nil, err
+	}
+	return p.buffer.Bytes(), nil
+}
+
+// decodeObject decodes line as a single JSON object.
+func decodeObject(line []byte) (map[string]any, error) {
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(line[dec.InputOffset():])) > 0 {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("value is not an object")
+	}
+	return object, nil
+}
+
+// noValueFunc is the name of the template function used to render missing values.
+const noValueFunc = "_noValue"
+
+// noValue renders missing values, which text/template would otherwise render as
+// "<no value>", as an empty string.
+func noValue(v any) any {
+	if v == nil {
+		return ""
+	}
+	return v
+}
+
+// renderNoValue appends noValueFunc to the pipeline of each action in node that renders
+// output.
+func renderNoValue(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			renderNoValue(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return // Variable declarations do not render output.
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(noValueFunc).SetTree(tree).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		renderNoValue(tree, n.List)
+		renderNoValue(tree, n.ElseList)
+	case *parse.RangeNode:
+		renderNoValue(tree, n.List)
+		renderNoValue(tree, n.ElseList)
+	case *parse.WithNode:
+		renderNoValue(tree, n.List)
+		renderNoValue(tree, n.ElseList)
+	}
+}
+
+// fieldFunc is the name of the template function used to access nested fields.
+const fieldFunc = "_field"
+
+// field returns the nested field of v identified by names, or nil if any field along the
+// way is missing or null. Names that do not identify a map key are evaluated as methods
+// without arguments, like text/template does, for example to call json.Number.String.
+func field(v any, names ...string) (any, error) {
+	for _, name := range names {
+		if v == nil {
+			return nil, nil
+		}
+		if m, ok := v.(map[string]any); ok {
+			v = m[name]
+			continue
+		}
+		method := reflect.ValueOf(v).MethodByName(name)
+		if !method.IsValid() || method.Type().NumIn() > 0 || method.Type().NumOut() == 0 {
+			return nil, fmt.Errorf("can't evaluate field %s in type %T", name, v)
+		}
+		out := method.Call(nil)
+		if len(out) > 1 {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return nil, err
+			}
+		}
+		v = out[0].Interface()
+	}
+	return v, nil
+}
+
+// safeFieldAccess rewrites chained field accesses in node, such as .a.b, $x.a.b and
+// (.a).b, into calls to fieldFunc, which text/template would otherwise fail to evaluate
+// if a field along the way is missing or null.
+func safeFieldAccess(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			safeFieldAccess(tree, child)
+		}
+	case *parse.ActionNode:
+		safeFieldAccessPipe(tree, n.Pipe)
+	case *parse.IfNode:
+		safeFieldAccessBranch(tree, &n.BranchNode)
+	case *parse.RangeNode:
+		safeFieldAccessBranch(tree, &n.BranchNode)
+	case *parse.WithNode:
+		safeFieldAccessBranch(tree, &n.BranchNode)
+	case *parse.TemplateNode:
+		safeFieldAccessPipe(tree, n.Pipe)
+	}
+}
+
+func safeFieldAccessBranch(tree *parse.Tree, n *parse.BranchNode) {
+	safeFieldAccessPipe(tree, n.Pipe)
+	safeFieldAccess(tree, n.List)
+	safeFieldAccess(tree, n.ElseList)
+}
+
+func safeFieldAccessPipe(tree *parse.Tree, pipe *parse.PipeNode) {
+	if pipe == nil {
+		return
+	}
+	for i, cmd := range pipe.Cmds {
+		for j, arg := range cmd.Args {
+			if p, ok := arg.(*parse.PipeNode); ok {
+				safeFieldAccessPipe(tree, p)
+				continue
+			}
+			call := fieldCall(tree, arg)
+			if call == nil {
+				continue
+			}
+			switch {
+			case j > 0:
+				cmd.Args[j] = &parse.PipeNode{NodeType: parse.NodePipe, Pos: call.Pos, Cmds: []*parse.CommandNode{call}}
+			case i == 0 && len(cmd.Args) == 1:
+				cmd.Args = call.Args
+			}
+			// Otherwise, the field is called as a method with arguments, which is left
+			// as-is.
+		}
+	}
+}
+
+// fieldCall returns a command that calls fieldFunc to evaluate node, or nil if node is
+// not a chained field access.
+func fieldCall(tree *parse.Tree, node parse.Node) *parse.CommandNode {
+	var receiver parse.Node
+	var names []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		if len(n.Ident) < 2 {
+			return nil
+		}
+		receiver = &parse.DotNode{NodeType: parse.NodeDot, Pos: n.Pos}
+		names = n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) < 2 {
+			return nil
+		}
+		receiver = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: n.Ident[:1]}
+		names = n.Ident[1:]
+	case *parse.ChainNode:
+		if p, ok := n.Node.(*parse.PipeNode); ok {
+			safeFieldAccessPipe(tree, p)
+		}
+		receiver = n.Node
+		names = n.Field
+	default:
+		return nil
+	}
+
+	pos := node.Position()
+	args := []parse.Node{parse.NewIdentifier(fieldFunc).SetTree(tree).SetPos(pos), receiver}
+	for _, name := range names {
+		args = append(args, &parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(name), Text: name})
+	}
+	return &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pos, Args: args}
+}
+
+// ansiColors maps color names to ANSI escape codes for the "color" template function.
+var ansiColors = map[string]string{
+	"black":   "\x1b[30m",
+	"red":     "\x1b[31m",
+	"green":   "\x1b[32m",
+	"yellow":  "\x1b[33m",
+	"blue":    "\x1b[34m",
+	"magenta": "\x1b[35m",
+	"cyan":    "\x1b[36m",
+	"white":   "\x1b[37m",
+	"gray":    "\x1b[90m",
+	"bold":    "\x1b[1m",
+	"dim":     "\x1b[2m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// levelColors maps normalized levels to colors for the "colorLevel" template function.
+var levelColors = map[string]string{
+	"trace": "gray",
+	"debug": "cyan",
+	"info":  "green",
+	"warn":  "yellow",
+	"error": "red",
+	"fatal": "magenta",
+}
+
+// TemplateFuncs returns the functions available to Template, in addition to the standard
+// text/template functions:
+//
+//   - color NAME VALUE: wraps VALUE in ANSI escape codes for the named color, e.g. "red"
+//   - colorLevel LEVEL: colors LEVEL based on its severity - see NormalizeLevel
+//   - pad N VALUE: pads VALUE with spaces on the right to at least N characters
+//   - padLeft N VALUE: pads VALUE with spaces on the left to at least N characters
+//   - truncate N VALUE: truncates VALUE to at most N characters, ending with "..."
+//   - formatTime LAYOUT VALUE: parses a timestamp string or Unix timestamp and formats
+//     it with the given time layout, or returns VALUE as-is if it cannot be parsed
+//   - default DEFAULT VALUE: returns DEFAULT if VALUE is missing or empty
+//   - json VALUE: encodes VALUE as compact JSON
+//   - upper VALUE, lower VALUE: changes the case of VALUE
+//
+// If color is false, "color" and "colorLevel" return their input without escape codes.
+func TemplateFuncs(color bool) template.FuncMap {
+	colorize := func(name string, v any) string {
+		s := toString(v)
+		code, ok := ansiColors[name]
+		if !color || !ok {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	return template.FuncMap{
+		"color": colorize,
+		"colorLevel": func(level any) string {
+			s := toString(level)
+			return colorize(levelColors[NormalizeLevel(s)], s)
+		},
+		"pad": func(n int, v any) string {
+			s := toString(v)
+			if pad := n - utf8.RuneCountInString(s); pad > 0 {
+				return s + strings.Repeat(" ", pad)
+			}
+			return s
+		},
+		"padLeft": func(n int, v any) string {
+			s := toString(v)
+			if pad := n - utf8.RuneCountInString(s); pad > 0 {
+				return strings.Repeat(" ", pad) + s
+			}
+			return s
+		},
+		"truncate": func(n int, v any) string {
+			s := toString(v)
+			if utf8.RuneCountInString(s) <= n {
+				return s
+			}
+			if n <= 3 {
+				return string([]rune(s)[:n])
+			}
+			return string([]rune(s)[:n-3]) + "..."
+		},
+		"formatTime": func(layout string, v any) string {
+			ts, ok := parseTimestamp(v)
+			if !ok {
+				return toString(v)
+			}
+			return ts.Format(layout)
+		},
+		"default": func(def, v any) any {
+			if v == nil || v == "" {
+				return def
+			}
+			return v
+		},
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"upper": func(v any) string { return strings.ToUpper(toString(v)) },
+		"lower": func(v any) string { return strings.ToLower(toString(v)) },
+	}
+}
+
+// toString formats template values for text output.
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
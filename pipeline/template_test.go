@@ -0,0 +1,161 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+func TestTemplate(t *testing.T) {
+	input := `{"level":"info","msg":"starting server","port":8080}
+plain text line
+{"level":"error","msg":"failed to connect to the database","ts":"2022-10-01T12:30:00Z"}`
+
+	for _, tc := range []struct {
+		name     string
+		template string
+		opts     pipeline.TemplateOptions
+		// input overrides the default input, if set.
+		input string
+		want  autogold.Value
+	}{
+		{
+			name:     "basic",
+			template: "{{.level}} {{.msg}}",
+			want: autogold.Expect([]string{
+				"info starting server", "plain text line",
+				"error failed to connect to the database",
+			}),
+		},
+		{
+			name:     "helpers",
+			template: `[{{pad 5 (upper .level)}}] {{truncate 20 .msg}} {{default "-" .port}} {{formatTime "15:04" .ts}}`,
+			opts:     pipeline.TemplateOptions{NonJSON: pipeline.NonJSONSkip},
+			want: autogold.Expect([]string{
+				"[INFO ] starting server 8080 ",
+				"[ERROR] failed to connect... - 12:30",
+			}),
+		},
+		{
+			name:     "colors",
+			template: `{{colorLevel .level}} {{color "bold" .msg}}`,
+			opts:     pipeline.TemplateOptions{NonJSON: pipeline.NonJSONSkip},
+			want: autogold.Expect([]string{
+				"\x1b[32minfo\x1b[0m \x1b[1mstarting server\x1b[0m",
+				"\x1b[31merror\x1b[0m \x1b[1mfailed to connect to the database\x1b[0m",
+			}),
+		},
+		{
+			name:     "no colors",
+			template: `{{colorLevel .level}} {{color "bold" .msg}}`,
+			opts:     pipeline.TemplateOptions{NonJSON: pipeline.NonJSONSkip, NoColor: true},
+			want: autogold.Expect([]string{
+				"info starting server",
+				"error failed to connect to the database",
+			}),
+		},
+		{
+			name:     "wrap non-JSON",
+			template: `{{if .raw}}> {{.raw}}{{else}}{{json .}}{{end}}`,
+			opts:     pipeline.TemplateOptions{NonJSON: pipeline.NonJSONWrap},
+			want: autogold.Expect([]string{
+				`{"level":"info","msg":"starting server","port":8080}`,
+				"> plain text line",
+				`{"level":"error","msg":"failed to connect to the database","ts":"2022-10-01T12:30:00Z"}`,
+			}),
+		},
+		{
+			name:     "custom funcs",
+			template: `{{shout .msg}}`,
+			opts: pipeline.TemplateOptions{
+				NonJSON: pipeline.NonJSONSkip,
+				Funcs: template.FuncMap{
+					"shout": func(s string) string { return strings.ToUpper(s) + "!" },
+				},
+			},
+			want: autogold.Expect([]string{"STARTING SERVER!", "FAILED TO CONNECT TO THE DATABASE!"}),
+		},
+		{
+			name:     "missing nested parent",
+			template: `{{.level}}:{{.http.status}}:{{default "-" .http.status}}:{{if .http.status}}set{{end}}`,
+			input:    `{"level":"info"}` + "\n" + `{"level":"warn","http":{"status":503}}`,
+			want:     autogold.Expect([]string{"info::-:", "warn:503:503:set"}),
+		},
+		{
+			name:     "null nested parent",
+			template: `{{.level}}:{{.http.status}}:{{with $l := .}}{{$l.http.status}}{{end}}:{{(.http).status}}:{{.http.status.String}}`,
+			input:    `{"level":"info","http":null}` + "\n" + `{"level":"warn","http":{"status":503}}`,
+			want:     autogold.Expect([]string{"info::::", "warn:503:503:503:503"}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			in := input
+			if tc.input != "" {
+				in = tc.input
+			}
+			lines, err := streamline.New(strings.NewReader(in)).
+				WithPipeline(pipeline.Template(tc.template, tc.opts)).
+				Lines()
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+
+	t.Run("non-JSON error", func(t *testing.T) {
+		t.Parallel()
+
+		p := pipeline.Template("{{.msg}}", pipeline.TemplateOptions{NonJSON: pipeline.NonJSONError})
+		_, err := p.ProcessLine([]byte(`{"msg":"hello"} trailing`))
+		require.Error(t, err)
+		autogold.Expect(`json: unexpected data after JSON value: {"msg":"hello"} trailing`).Equal(t, err.Error())
+
+		_, err = p.ProcessLine([]byte(`{"msg":"hello"}}`))
+		require.Error(t, err)
+		autogold.Expect(`json: unexpected data after JSON value: {"msg":"hello"}}`).Equal(t, err.Error())
+
+		_, err = p.ProcessLine([]byte(`100`))
+		require.Error(t, err)
+		autogold.Expect("json: value is not an object: 100").Equal(t, err.Error())
+	})
+
+	t.Run("scalar JSON lines", func(t *testing.T) {
+		t.Parallel()
+
+		lines, err := streamline.New(strings.NewReader("100\ntrue\nnull\n\"x\"\n[1]\n{\"level\":\"info\"}")).
+			WithPipeline(pipeline.Template("{{.level}}", pipeline.TemplateOptions{})).
+			Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"100", "true", "null", `"x"`, "[1]", "info"}).Equal(t, lines)
+	})
+
+	t.Run("missing keys", func(t *testing.T) {
+		t.Parallel()
+
+		p := pipeline.Template(`{{.level}} {{.msg}}|{{if .msg}}{{.msg}}{{else}}{{.missing}}{{end}}|{{with $x := .level}}{{$x}}{{end}}`,
+			pipeline.TemplateOptions{})
+		line, err := p.ProcessLine([]byte(`{"level":"info"}`))
+		require.NoError(t, err)
+		autogold.Expect("info ||info").Equal(t, string(line))
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := pipeline.BuildTemplate("{{.msg", pipeline.TemplateOptions{})
+		assert.Error(t, err)
+
+		p := pipeline.Template("{{.msg", pipeline.TemplateOptions{})
+		l, err := p.ProcessLine([]byte(`{"msg":"hello"}`))
+		assert.Empty(t, l)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TimestampFormat indicates how Timestamp annotates lines.
+type TimestampFormat int
+
+const (
+	// TimestampWallClock annotates lines with the time each line was processed, formatted
+	// with TimestampOptions.Layout. It is the default format.
+	TimestampWallClock TimestampFormat = iota
+	// TimestampRelative annotates lines with the time elapsed since
+	// TimestampOptions.Start, similar to 'ts -s'.
+	TimestampRelative
+	// TimestampDelta annotates lines with the time elapsed since the previous line,
+	// similar to 'ts -i'.
+	TimestampDelta
+)
+
+// TimestampOptions configures Timestamp.
+type TimestampOptions struct {
+	// Format indicates how lines should be annotated. The default is TimestampWallClock.
+	Format TimestampFormat
+	// Layout is the time layout used by TimestampWallClock. The default is time.RFC3339.
+	Layout string
+	// Separator is placed between the timestamp and the line. The default is a single
+	// space.
+	Separator string
+	// Start is the reference time for TimestampRelative. If zero, the time of the first
+	// line is used.
+	Start time.Time
+	// Clock provides the current time. The default is time.Now - it can be configured to
+	// make output deterministic, for example in tests.
+	Clock func() time.Time
+	// ParseExisting indicates that instead of adding timestamps based on Clock,
+	// timestamps already present at the start of lines should be parsed and replaced
+	// with the configured Format, similar to 'ts -r'. Lines without a recognized leading
+	// timestamp are left unmodified. Clock is used to infer the year of syslog
+	// timestamps, which do not include one.
+	ParseExisting bool
+}
+
+// Timestamp is a Pipeline that annotates each line with a timestamp, configured by opts.
+func Timestamp(opts TimestampOptions) Pipeline {
+	if opts.Layout == "" {
+		opts.Layout = time.RFC3339
+	}
+	if opts.Separator == "" {
+		opts.Separator = " "
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	return &timestamper{opts: opts, start: opts.Start}
+}
+
+type timestamper struct {
+	opts TimestampOptions
+
+	start    time.Time
+	previous time.Time
+}
+
+func (t *timestamper) ProcessLine(line []byte) ([]byte, error) {
+	if !t.opts.ParseExisting {
+		stamp := t.format(t.opts.Clock())
+		out := make([]byte, 0, len(stamp)+len(t.opts.Separator)+len(line))
+		out = append(out, stamp...)
+		out = append(out, t.opts.Separator...)
+		return append(out, line...), nil
+	}
+
+	ts, start, end, ok := findLeadingTimestamp(line, t.opts.Clock)
+	if !ok {
+		return line, nil
+	}
+	stamp := t.format(ts)
+	out := make([]byte, 0, len(line)-(end-start)+len(stamp))
+	out = append(out, line[:start]...)
+	out = append(out, stamp...)
+	return append(out, line[end:]...), nil
+}
+
+// format formats ts according to the configured format, and records it as the most
+// recent timestamp.
+func (t *timestamper) format(ts time.Time) string {
+	if t.start.IsZero() {
+		t.start = ts
+	}
+	if t.previous.IsZero() {
+		t.previous = ts
+	}
+	defer func() { t.previous = ts }()
+
+	switch t.opts.Format {
+	case TimestampRelative:
+		return formatElapsed(ts.Sub(t.start))
+	case TimestampDelta:
+		return formatElapsed(ts.Sub(t.previous))
+	default:
+		return ts.Format(t.opts.Layout)
+	}
+}
+
+// formatElapsed formats d as HH:MM:SS.mmm, similar to the output of 'ts -s'.
+func formatElapsed(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	d = d.Round(time.Millisecond)
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	s := d / time.Second
+	d -= s * time.Second
+	return fmt.Sprintf("%s%02d:%02d:%02d.%03d", sign, h, m, s, d/time.Millisecond)
+}
+
+// leadingTimestampPattern matches common timestamp formats at the start of a line,
+// optionally wrapped in brackets: ISO8601/RFC3339-like timestamps, syslog timestamps,
+// and Unix timestamps in seconds or milliseconds.
+var leadingTimestampPattern = regexp.MustCompile(
+	`^\[?(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2}| [+-]\d{4})?|[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{10}(?:\d{3}|\.\d+)?)\b`)
+
+// findLeadingTimestamp parses a timestamp at the start of line, returning the offsets of
+// the timestamp within the line. clock is used to infer the year of syslog timestamps.
+func findLeadingTimestamp(line []byte, clock func() time.Time) (ts time.Time, start, end int, ok bool) {
+	m := leadingTimestampPattern.FindSubmatchIndex(line)
+	if m == nil {
+		return time.Time{}, 0, 0, false
+	}
+	start, end = m[2], m[3]
+	raw := strings.Replace(string(line[start:end]), ",", ".", 1)
+
+	if ts, err := parseSyslogTimestamp(raw, clock()); err == nil {
+		return ts, start, end, true
+	}
+	if ts, ok := parseTimestamp(raw); ok {
+		return ts, start, end, true
+	}
+	return time.Time{}, 0, 0, false
+}
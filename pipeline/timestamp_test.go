@@ -0,0 +1,134 @@
+package pipeline_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/require"
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// fakeClock returns a clock that starts at start and advances by each of steps on each
+// call.
+func fakeClock(start time.Time, steps ...time.Duration) func() time.Time {
+	current := start
+	var calls int
+	return func() time.Time {
+		if calls > 0 && calls-1 < len(steps) {
+			current = current.Add(steps[calls-1])
+		}
+		calls++
+		return current
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	start := time.Date(2022, time.October, 1, 12, 30, 0, 0, time.UTC)
+	input := "compiling...\nlinking...\ndone!"
+
+	for _, tc := range []struct {
+		name  string
+		opts  pipeline.TimestampOptions
+		input string
+		want  autogold.Value
+	}{
+		{
+			name: "wall clock",
+			opts: pipeline.TimestampOptions{
+				Clock: fakeClock(start, time.Second, 90*time.Second),
+			},
+			input: input,
+			want: autogold.Expect([]string{
+				"2022-10-01T12:30:00Z compiling...",
+				"2022-10-01T12:30:01Z linking...",
+				"2022-10-01T12:31:31Z done!",
+			}),
+		},
+		{
+			name: "custom layout and separator",
+			opts: pipeline.TimestampOptions{
+				Layout:    time.Kitchen,
+				Separator: " | ",
+				Clock:     fakeClock(start, time.Hour),
+			},
+			input: "foo\nbar",
+			want:  autogold.Expect([]string{"12:30PM | foo", "1:30PM | bar"}),
+		},
+		{
+			name: "relative",
+			opts: pipeline.TimestampOptions{
+				Format: pipeline.TimestampRelative,
+				Clock:  fakeClock(start, 1500*time.Millisecond, 2*time.Hour),
+			},
+			input: input,
+			want: autogold.Expect([]string{
+				"00:00:00.000 compiling...",
+				"00:00:01.500 linking...",
+				"02:00:01.500 done!",
+			}),
+		},
+		{
+			name: "relative to start",
+			opts: pipeline.TimestampOptions{
+				Format: pipeline.TimestampRelative,
+				Start:  start.Add(-time.Minute),
+				Clock:  fakeClock(start),
+			},
+			input: "foo",
+			want:  autogold.Expect([]string{"00:01:00.000 foo"}),
+		},
+		{
+			name: "delta",
+			opts: pipeline.TimestampOptions{
+				Format: pipeline.TimestampDelta,
+				Clock:  fakeClock(start, 1500*time.Millisecond, 250*time.Millisecond),
+			},
+			input: input,
+			want: autogold.Expect([]string{
+				"00:00:00.000 compiling...",
+				"00:00:01.500 linking...",
+				"00:00:00.250 done!",
+			}),
+		},
+		{
+			name: "parse existing timestamps",
+			opts: pipeline.TimestampOptions{
+				Format:        pipeline.TimestampDelta,
+				ParseExisting: true,
+				Clock: func() time.Time {
+					return time.Date(2022, time.October, 2, 0, 0, 0, 0, time.UTC)
+				},
+			},
+			input: "2022-10-01 12:30:00,100 INFO starting\nno timestamp here\n[2022-10-01T12:30:02.350Z] WARN slow\nOct  1 12:30:04 myhost app: retrying\n1664627405 ERROR failed",
+			want: autogold.Expect([]string{
+				"00:00:00.000 INFO starting", "no timestamp here",
+				"[00:00:02.250] WARN slow",
+				"00:00:01.650 myhost app: retrying",
+				"00:00:01.000 ERROR failed",
+			}),
+		},
+		{
+			name: "normalize existing timestamps",
+			opts: pipeline.TimestampOptions{
+				Layout:        time.RFC3339Nano,
+				ParseExisting: true,
+			},
+			input: "2022-10-01 12:30:00.1 +0200 INFO starting",
+			want:  autogold.Expect([]string{"2022-10-01T12:30:00.1+02:00 INFO starting"}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			lines, err := streamline.New(strings.NewReader(tc.input)).
+				WithPipeline(pipeline.Timestamp(tc.opts)).
+				Lines()
+			require.NoError(t, err)
+			tc.want.Equal(t, lines)
+		})
+	}
+}
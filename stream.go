@@ -47,6 +47,8 @@ type LineReader interface {
 type Stream struct {
 	// reader carries the input data and the current read state.
 	reader LineReader
+	// closer, if set, is the input, to be closed by (*Stream).Close().
+	closer io.Closer
 
 	// pipeline, if active, must be used to pre-process lines.
 	pipeline pipeline.MultiPipeline
@@ -57,6 +59,9 @@ type Stream struct {
 
 	// lineSeparator is used as the read delimiter.
 	lineSeparator byte
+
+	// flushed indicates that pipelines have been flushed at the end of the input.
+	flushed bool
 }
 
 // New creates a Stream that consumes, processes, and emits data from the input. If the
@@ -69,8 +74,10 @@ func New(input io.Reader) *Stream {
 	} else {
 		reader = bufio.NewReader(input)
 	}
+	closer, _ := input.(io.Closer)
 	return &Stream{
 		reader:        reader,
+		closer:        closer,
 		lineSeparator: '\n',
 	}
 }
@@ -91,6 +98,17 @@ func (s *Stream) WithLineSeparator(separator byte) *Stream {
 	return s
 }
 
+// Close closes the input if it implements io.Closer, and otherwise does nothing. It can
+// be used to release resources held by the input if the Stream is not read to completion,
+// for example temporary files held by Streams created with package pipe. Reads after
+// Close may return an error.
+func (s *Stream) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
 // Stream passes lines read from the input to the handler as it processes them. It is
 // intended for simple use cases - to be able to provide errors from the line handler, use
 // StreamBytes instead.
@@ -201,7 +219,9 @@ func (s *Stream) Read(p []byte) (int, error) {
 	for {
 		var currentLine []byte
 		skipped, err := s.readLine(func(next []byte) error {
-			currentLine = append(next, s.lineSeparator)
+			// The handler may be called multiple times for multi-line pipeline output.
+			currentLine = append(currentLine, next...)
+			currentLine = append(currentLine, s.lineSeparator)
 			return nil
 		})
 
@@ -241,8 +261,8 @@ func (s *Stream) Read(p []byte) (int, error) {
 	}
 }
 
-// readLine consumes a single line in the stream. The error returned, in order of
-// precedence, is one of:
+// readLine consumes a single line in the stream, and flushes the pipelines once the
+// input is exhausted. The error returned, in order of precedence, is one of:
 //
 //   - processing error
 //   - handler error
@@ -251,6 +271,29 @@ func (s *Stream) Read(p []byte) (int, error) {
 // The read error in particular may be io.EOF, which the caller should handle on a
 // case-by-case basis.
 func (s *Stream) readLine(handle func(line []byte) error) (skipped bool, err error) {
+	skipped, err = s.readNextLine(handle)
+	if !errors.Is(err, io.EOF) || s.flushed || len(s.pipeline) == 0 {
+		return skipped, err
+	}
+
+	// The input is exhausted - flush pipelines that buffer lines. Pipeline output has
+	// already been processed by subsequent pipelines.
+	s.flushed = true
+	var handled bool
+	if flushErr := s.pipeline.FlushLines(s.lineSeparator, func(line []byte) error {
+		handled = true
+		return handle(line)
+	}); flushErr != nil {
+		return false, flushErr
+	}
+	if !handled {
+		return skipped, err
+	}
+	return false, err
+}
+
+// readNextLine consumes a single line from the input - see readLine.
+func (s *Stream) readNextLine(handle func(line []byte) error) (skipped bool, err error) {
 	var line []byte
 	var readErr error
 	for {
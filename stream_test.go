@@ -366,3 +366,67 @@ func TestStreamWithLineSeparator(t *testing.T) {
 		"Compressing objects:  17% (737/4334)",
 	}).Equal(t, lines)
 }
+
+func TestStreamWithFlushingPipeline(t *testing.T) {
+	newStream := func() *streamline.Stream {
+		return streamline.New(strings.NewReader("foo\n{\n  \"a\": 1")).
+			WithPipeline(pipeline.ReassembleJSON(pipeline.ReassembleJSONOptions{})).
+			WithPipeline(pipeline.Map(func(line []byte) []byte {
+				return bytes.TrimSpace(line)
+			}))
+	}
+
+	t.Run("Lines", func(t *testing.T) {
+		t.Parallel()
+
+		lines, err := newStream().Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"foo", "{", `"a": 1`}).Equal(t, lines)
+	})
+
+	t.Run("io.ReadAll", func(t *testing.T) {
+		t.Parallel()
+
+		all, err := io.ReadAll(newStream())
+		require.NoError(t, err)
+		autogold.Expect("foo\n{\n\"a\": 1\n").Equal(t, string(all))
+	})
+
+	t.Run("WithLineSeparator", func(t *testing.T) {
+		t.Parallel()
+
+		lines, err := streamline.New(strings.NewReader("foo\x00bar")).
+			WithLineSeparator(0).
+			WithPipeline(flushingPipeline("multi\nline\x00last")).
+			Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"foo", "bar", "multi\nline", "last"}).Equal(t, lines)
+	})
+}
+
+func TestStreamClose(t *testing.T) {
+	t.Run("closes input", func(t *testing.T) {
+		t.Parallel()
+
+		r, w := io.Pipe()
+		stream := streamline.New(r)
+		require.NoError(t, stream.Close())
+
+		_, err := w.Write([]byte("foo\n"))
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+	})
+
+	t.Run("input is not a closer", func(t *testing.T) {
+		t.Parallel()
+
+		stream := streamline.New(strings.NewReader("foo"))
+		require.NoError(t, stream.Close())
+	})
+}
+
+// flushingPipeline passes lines through unmodified, and emits its contents on Flush.
+type flushingPipeline string
+
+func (p flushingPipeline) ProcessLine(line []byte) ([]byte, error) { return line, nil }
+
+func (p flushingPipeline) Flush() ([]byte, error) { return []byte(p), nil }
@@ -0,0 +1,158 @@
+package streamexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipeline"
+)
+
+// Stage is a stage of a Chain, created with Command, CommandWithOptions, or Pipeline.
+type Stage struct {
+	cmd      *exec.Cmd
+	opts     Options
+	pipeline pipeline.Pipeline
+}
+
+// Command creates a Stage that runs cmd with the output of the previous stage as its
+// stdin. Only the command's stdout is passed to the next stage - stderr output is
+// retained for ExitError, and can also be collected by setting cmd.Stderr.
+func Command(cmd *exec.Cmd) Stage { return Stage{cmd: cmd} }
+
+// CommandWithOptions is the same as Command, but configures the command and its output
+// with opts. Options.Stdin must not be set, except on the first stage of a Chain.
+func CommandWithOptions(cmd *exec.Cmd, opts Options) Stage { return Stage{cmd: cmd, opts: opts} }
+
+// Pipeline creates a Stage that processes the output of the previous stage with p.
+func Pipeline(p pipeline.Pipeline) Stage { return Stage{pipeline: p} }
+
+// StageError indicates that a stage of a Chain failed.
+type StageError struct {
+	// Stage is the index of the failed stage in the Chain.
+	Stage int
+	// Command is the command line of the failed stage, or nil if the stage is a Pipeline.
+	Command []string
+	// Err is the error from the stage, typically an *ExitError for commands.
+	Err error
+}
+
+func (e *StageError) Error() string {
+	if e.Command == nil {
+		return fmt.Sprintf("stage %d (pipeline): %s", e.Stage, e.Err.Error())
+	}
+	return fmt.Sprintf("stage %d (%s): %s", e.Stage, strings.Join(e.Command, " "), e.Err.Error())
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// chainStage tracks a command started as a stage of a Chain.
+type chainStage struct {
+	index int
+	// upstream is the previous command in the Chain, if any.
+	upstream *chainStage
+	// stop stops the command's output from being consumed, which causes the command to
+	// receive SIGPIPE on its next write. It is set by start.
+	stop func()
+}
+
+// Chain starts a shell-like pipeline of commands, such as 'grep foo | sort | uniq', where
+// the output of each stage is streamed to the next. Stages can be commands or Pipelines,
+// and the Chain must start with a command. Each command is started with StartContext,
+// and its stdout is passed to the next stage through a buffer configured by its Options -
+// stdout of the final command, processed with any trailing Pipelines, is returned as a
+// Stream.
+//
+//	stream, err := streamexec.Chain(ctx,
+//		streamexec.Command(exec.Command("cat", "access.log")),
+//		streamexec.Pipeline(pipeline.Filter(func(line []byte) bool {
+//			return bytes.Contains(line, []byte("GET"))
+//		})),
+//		streamexec.Command(exec.Command("sort")),
+//		streamexec.Command(exec.Command("uniq", "-c")))
+//
+// If any stage fails, the Stream ends with a *StageError that indicates which stage
+// failed. Errors from earlier stages take precedence, since later stages often fail as a
+// consequence. If a command exits without consuming all of its input, for example with
+// 'head -n 1', earlier stages stop being consumed and receive SIGPIPE on their next write
+// like they would in a shell, and their resulting errors are ignored.
+//
+// If a command fails to start, Chain returns a *StageError, and commands that have
+// already started are stopped as if the failed command had exited early.
+func Chain(ctx context.Context, stages ...Stage) (*streamline.Stream, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("chain has no stages")
+	}
+	if stages[0].cmd == nil {
+		return nil, errors.New("chain must start with a command")
+	}
+	for i, s := range stages {
+		switch {
+		case s.cmd == nil && s.pipeline == nil:
+			return nil, &StageError{Stage: i, Err: errors.New("stage has no command or pipeline")}
+		case i > 0 && s.opts.Stdin != nil:
+			return nil, &StageError{Stage: i, Command: s.cmd.Args,
+				Err: errors.New("Options.Stdin can only be set on the first stage")}
+		}
+	}
+
+	var stream *streamline.Stream
+	var upstream *chainStage
+	for i, s := range stages {
+		if s.cmd == nil {
+			stream = stream.WithPipeline(&stagePipeline{Pipeline: s.pipeline, index: i})
+			continue
+		}
+
+		opts := s.opts
+		if i > 0 {
+			opts.Stdin = stream
+		}
+		stage := &chainStage{index: i, upstream: upstream}
+		setProcessGroup(s.cmd)
+		next, err := start(ctx, s.cmd, opts, modeSet{Stdout}, stage)
+		if err != nil {
+			if upstream != nil {
+				// Nothing will consume the previous stages, so stop them and release
+				// their output.
+				upstream.stop()
+				_ = stream.Close()
+			}
+			return nil, &StageError{Stage: i, Command: s.cmd.Args, Err: err}
+		}
+		stream = next
+		upstream = stage
+	}
+	return stream, nil
+}
+
+// stagePipeline attributes errors from a Pipeline stage of a Chain.
+type stagePipeline struct {
+	pipeline.Pipeline
+	index int
+}
+
+var _ pipeline.Flusher = (*stagePipeline)(nil)
+
+func (p *stagePipeline) ProcessLine(line []byte) ([]byte, error) {
+	line, err := p.Pipeline.ProcessLine(line)
+	if err != nil {
+		return line, &StageError{Stage: p.index, Err: err}
+	}
+	return line, nil
+}
+
+func (p *stagePipeline) Flush() ([]byte, error) {
+	f, ok := p.Pipeline.(pipeline.Flusher)
+	if !ok {
+		return nil, nil
+	}
+	output, err := f.Flush()
+	if err != nil {
+		return output, &StageError{Stage: p.index, Err: err}
+	}
+	return output, nil
+}
@@ -0,0 +1,234 @@
+package streamexec_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipe"
+	"go.bobheadxi.dev/streamline/pipeline"
+	"go.bobheadxi.dev/streamline/streamexec"
+)
+
+func TestStdin(t *testing.T) {
+	t.Run("with pipelines", func(t *testing.T) {
+		t.Parallel()
+
+		input := streamline.New(strings.NewReader("hello\nworld\nfoo")).
+			WithPipeline(pipeline.Filter(func(line []byte) bool {
+				return !bytes.Equal(line, []byte("foo"))
+			}))
+		cmd := exec.Command("tr", "a-z", "A-Z")
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{Stdin: input})
+		require.NoError(t, err)
+
+		lines, err := stream.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"HELLO", "WORLD"}).Equal(t, lines)
+	})
+
+	t.Run("input error", func(t *testing.T) {
+		t.Parallel()
+
+		writer, input := pipe.NewStream()
+		writer.Write([]byte("hello\n"))
+		writer.CloseWithError(errors.New("input failed"))
+
+		cmd := exec.Command("cat")
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{Stdin: input})
+		require.NoError(t, err)
+
+		out, err := stream.String()
+		autogold.Expect("hello").Equal(t, out)
+		require.Error(t, err)
+		autogold.Expect("input failed").Equal(t, err.Error())
+	})
+
+	t.Run("command does not consume input", func(t *testing.T) {
+		t.Parallel()
+
+		writer, input := pipe.NewStream()
+		defer writer.CloseWithError(nil)
+		writer.Write([]byte("hello\n"))
+
+		cmd := exec.Command("echo", "done")
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{Stdin: input})
+		require.NoError(t, err)
+
+		out, err := stream.String()
+		require.NoError(t, err)
+		autogold.Expect("done").Equal(t, out)
+	})
+
+	t.Run("cmd.Stdin already set", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("cat")
+		cmd.Stdin = strings.NewReader("hello")
+		_, err := streamexec.StartWithOptions(cmd, streamexec.Options{
+			Stdin: streamline.New(strings.NewReader("world")),
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestChain(t *testing.T) {
+	t.Run("commands and pipelines", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("printf", `b\na\nb\nc\nb\n`)),
+			streamexec.Pipeline(pipeline.Filter(func(line []byte) bool {
+				return !bytes.Equal(line, []byte("c"))
+			})),
+			streamexec.Command(exec.Command("sort")),
+			streamexec.Command(exec.Command("uniq", "-c")),
+			streamexec.Pipeline(pipeline.Map(bytes.TrimSpace)))
+		require.NoError(t, err)
+
+		lines, err := stream.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"1 a", "3 b"}).Equal(t, lines)
+	})
+
+	t.Run("downstream exits early", func(t *testing.T) {
+		t.Parallel()
+
+		start := time.Now()
+		stream, err := streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("yes")),
+			streamexec.Command(exec.Command("cat")),
+			streamexec.Command(exec.Command("head", "-n", "3")))
+		require.NoError(t, err)
+
+		lines, err := stream.Lines()
+		require.NoError(t, err)
+		autogold.Expect([]string{"y", "y", "y"}).Equal(t, lines)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("command error", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("bash", "-c", `echo "hello" ; >&2 echo "oh no" ; exit 3`)),
+			streamexec.Command(exec.Command("cat")))
+		require.NoError(t, err)
+
+		out, err := stream.String()
+		autogold.Expect("hello").Equal(t, out)
+		require.Error(t, err)
+		autogold.Expect(`stage 0 (bash -c echo "hello" ; >&2 echo "oh no" ; exit 3): exit status 3`).Equal(t, err.Error())
+
+		var stageErr *streamexec.StageError
+		require.True(t, errors.As(err, &stageErr))
+		assert.Equal(t, 0, stageErr.Stage)
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, 3, exitErr.ExitCode)
+		autogold.Expect([]string{"oh no"}).Equal(t, exitErr.StderrTail)
+	})
+
+	t.Run("last command error", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("echo", "hello")),
+			streamexec.Command(exec.Command("bash", "-c", `cat ; exit 2`)))
+		require.NoError(t, err)
+
+		_, err = stream.String()
+		require.Error(t, err)
+		autogold.Expect("stage 1 (bash -c cat ; exit 2): exit status 2").Equal(t, err.Error())
+	})
+
+	t.Run("pipeline error", func(t *testing.T) {
+		t.Parallel()
+
+		stream, err := streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("yes")),
+			streamexec.Pipeline(pipeline.MapIdx(func(i int, line []byte) ([]byte, error) {
+				if i == 10 {
+					return nil, errors.New("too many lines")
+				}
+				return line, nil
+			})),
+			streamexec.Command(exec.Command("cat")))
+		require.NoError(t, err)
+
+		lines, err := stream.Lines()
+		assert.Len(t, lines, 10)
+		require.Error(t, err)
+		autogold.Expect("stage 1 (pipeline): too many lines").Equal(t, err.Error())
+	})
+
+	t.Run("spill files of unconsumed stages are released", func(t *testing.T) {
+		t.Parallel()
+
+		for name, downstream := range map[string]streamexec.Stage{
+			"downstream exits early": streamexec.Command(exec.Command("head", "-n", "1")),
+			"pipeline error": streamexec.Pipeline(pipeline.MapIdx(func(i int, line []byte) ([]byte, error) {
+				if i == 10 {
+					return nil, errors.New("too many lines")
+				}
+				return line, nil
+			})),
+		} {
+			dir := t.TempDir()
+			stream, err := streamexec.Chain(context.Background(),
+				streamexec.CommandWithOptions(exec.Command("seq", "100000"), streamexec.Options{
+					Pipe: pipe.Options{MemoryLimit: 64, FileChunkSize: 1024, TempDir: dir},
+				}),
+				downstream,
+				streamexec.Command(exec.Command("cat")))
+			require.NoError(t, err, name)
+
+			_, _ = stream.Lines()
+			assert.Eventually(t, func() bool {
+				files, err := os.ReadDir(dir)
+				return err == nil && len(files) == 0
+			}, 5*time.Second, 10*time.Millisecond, name)
+		}
+	})
+
+	t.Run("failed to start", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("yes")),
+			streamexec.Command(exec.Command("foobar")))
+		require.Error(t, err)
+		var stageErr *streamexec.StageError
+		require.True(t, errors.As(err, &stageErr))
+		assert.Equal(t, 1, stageErr.Stage)
+	})
+
+	t.Run("invalid chains", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := streamexec.Chain(context.Background())
+		assert.Error(t, err)
+
+		_, err = streamexec.Chain(context.Background(),
+			streamexec.Pipeline(pipeline.Map(bytes.TrimSpace)),
+			streamexec.Command(exec.Command("cat")))
+		assert.Error(t, err)
+
+		_, err = streamexec.Chain(context.Background(),
+			streamexec.Command(exec.Command("echo")),
+			streamexec.CommandWithOptions(exec.Command("cat"), streamexec.Options{
+				Stdin: streamline.New(strings.NewReader("hello")),
+			}))
+		assert.Error(t, err)
+	})
+}
@@ -1,10 +1,9 @@
 package streamexec
 
 import (
-	"fmt"
-	"io"
+	"context"
 	"os/exec"
-	"strings"
+	"time"
 
 	"go.bobheadxi.dev/streamline"
 	"go.bobheadxi.dev/streamline/pipe"
@@ -22,9 +21,10 @@ const (
 	// Stderr only streams cmd.Stderr.
 	Stderr
 
-	// ErrWithStderr collects Stderr output and includes it in the returned error from
-	// Cmd.Start(). Best used with the Stdout StreamMode to avoid duplicating stderr
-	// output in the stream and in the returned error.
+	// ErrWithStderr includes the last lines of Stderr output, as configured by
+	// Options.StderrTailLines, in the error the Stream ends with. Best used with the
+	// Stdout StreamMode to avoid duplicating stderr output in the stream and in the
+	// returned error.
 	ErrWithStderr
 )
 
@@ -49,48 +49,136 @@ func (modes modeSet) getMode() StreamMode {
 // provided, they are all included.
 //
 // Instead of using cmd.Wait() for command completion, callers should read the returned
-// Stream until completion to indicate if the command has exited.
+// Stream until completion to indicate if the command has exited. If the command exits
+// unsuccessfully, the Stream ends with an *ExitError.
 //
 // Before consuming the Stream, the caller can configure the Stream as a normal stream
 // using e.g. WithPipeline.
 //
-// Output piping is handled by buffers created by streamline/pipe.NewStream(...).
+// Output piping is handled by buffers created by streamline/pipe.NewStream(...). To
+// configure the buffers, use StartWithOptions.
 func Start(cmd *exec.Cmd, modes ...StreamMode) (*streamline.Stream, error) {
-	pipeWriter, stream := pipe.NewStream()
+	return StartWithOptions(cmd, Options{}, modes...)
+}
+
+// Options configures StartWithOptions.
+type Options struct {
+	// Pipe configures the buffer used to pipe command output to the Stream - see
+	// pipe.NewStreamWithOptions.
+	Pipe pipe.Options
+
+	// Tag configures how each line of output is tagged with its source, so that lines
+	// from stdout and stderr can be told apart in Combined output. When tagging is
+	// enabled, output is only written to the Stream in complete lines, so lines from
+	// stdout and stderr are never interleaved within a line.
+	Tag TagFormat
+	// StdoutPrefix and StderrPrefix are used with TagPrefix, and default to
+	// DefaultStdoutPrefix and DefaultStderrPrefix respectively.
+	StdoutPrefix, StderrPrefix string
 
-	mode := modeSet(modes).getMode()
-	if mode&Stdout != 0 {
-		cmd.Stdout = pipeWriter
+	// StderrTailLines is the number of lines of stderr retained for ExitError.StderrTail
+	// and for errors from ErrWithStderr. If zero, DefaultStderrTailLines is used, and if
+	// negative, stderr is not retained.
+	StderrTailLines int
+
+	// GracePeriod is how long commands started with StartContext are given to exit after
+	// receiving SIGTERM before they are killed with SIGKILL. If zero, DefaultGracePeriod
+	// is used, and if negative, commands are killed immediately.
+	GracePeriod time.Duration
+
+	// Stdin, if set, is consumed as the command's input, including the output of any
+	// Pipelines configured on it. If reading Stdin fails, the command's input is closed,
+	// and the Stream ends with the error from Stdin. If the command exits without
+	// consuming all of Stdin, or reading Stdin fails, the rest of Stdin is not read and
+	// Stdin is closed with (*Stream).Close(). cmd.Stdin must not be set.
+	//
+	// To build pipelines of multiple commands, use Chain.
+	Stdin *streamline.Stream
+}
+
+// StartWithOptions is the same as Start, but configures the command and its Stream with
+// opts.
+func StartWithOptions(cmd *exec.Cmd, opts Options, modes ...StreamMode) (*streamline.Stream, error) {
+	return start(context.Background(), cmd, opts, modes, nil)
+}
+
+// start starts cmd. If stage is set, cmd is started as a stage of a Chain.
+func start(ctx context.Context, cmd *exec.Cmd, opts Options, modes modeSet, stage *chainStage) (*streamline.Stream, error) {
+	var pipeWriter pipe.WriterErrorCloser
+	pipeWriter, stream := pipe.NewStreamWithOptions(opts.Pipe)
+
+	mode := modes.getMode()
+	if opts.Tag != TagNone {
+		lineWriter := pipe.NewLineWriter(pipeWriter)
+		pipeWriter = lineWriter
+		if mode&Stdout != 0 {
+			cmd.Stdout = lineWriter.NewWriterFunc(opts.tagger(Stdout))
+		}
+		if mode&Stderr != 0 {
+			cmd.Stderr = lineWriter.NewWriterFunc(opts.tagger(Stderr))
+		}
+	} else {
+		if mode&Stdout != 0 {
+			cmd.Stdout = pipeWriter
+		}
+		if mode&Stderr != 0 {
+			cmd.Stderr = pipeWriter
+		}
 	}
-	if mode&Stderr != 0 {
-		cmd.Stderr = pipeWriter
+
+	if stage != nil {
+		stdout := &stoppableWriter{w: cmd.Stdout}
+		cmd.Stdout = stdout
+		stage.stop = stdout.stop
 	}
 
-	var stderr *strings.Builder
-	if mode&ErrWithStderr != 0 {
-		stderr = &strings.Builder{}
-		if cmd.Stderr == nil {
-			cmd.Stderr = stderr
-		} else {
-			cmd.Stderr = io.MultiWriter(cmd.Stderr, stderr)
+	stderr := newTailWriter(opts)
+	attachTail(cmd, stderr)
+
+	if err := ctx.Err(); err != nil {
+		pipeWriter.CloseWithError(nil) // Close pipe to let stream exit gracefully if used
+		return stream, err
+	}
+	var stdin *stdinCopier
+	if opts.Stdin != nil {
+		stdinPipe, err := cmd.StdinPipe()
+		if err != nil {
+			pipeWriter.CloseWithError(nil) // Close pipe to let stream exit gracefully if used
+			return stream, err
 		}
+		stdin = newStdinCopier(opts.Stdin, stdinPipe, stage)
 	}
 
 	// Start running the command in the background.
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
 		pipeWriter.CloseWithError(nil) // Close pipe to let stream exit gracefully if used
 		return stream, err
 	}
+	if stdin != nil {
+		go stdin.copy()
+	}
 
 	// Wait for the command to complete in the background so we can propagate the error
 	// back to the stream.
 	go func() {
-		err := cmd.Wait()
+		err, ctxErr := waitContext(ctx, cmd, opts.GracePeriod)
+		err = exitError(cmd, err, ctxErr, started, stderr)
 		// If we are tracking stderr and got some data, wrap the error with stderr output
-		if err != nil && stderr != nil && stderr.Len() > 0 {
-			err = fmt.Errorf("%w: %s", err, strings.TrimSuffix(stderr.String(), "\n"))
+		if err != nil && mode&ErrWithStderr != 0 {
+			err = withStderr(err, stderr)
+		}
+		if err != nil && stage != nil {
+			err = &StageError{Stage: stage.index, Command: cmd.Args, Err: err}
+		}
+		// Errors from reading input take precedence, since the command likely failed
+		// because of incomplete input.
+		if stdin != nil {
+			if stdinErr := stdin.result(); stdinErr != nil {
+				err = stdinErr
+			}
 		}
-		// Propagate command error to the stream
+		// Propagate command error to the stream, flushing any incomplete tagged lines
 		pipeWriter.CloseWithError(err)
 	}()
 
@@ -2,6 +2,7 @@ package streamexec_test
 
 import (
 	"bytes"
+	"os"
 	"os/exec"
 	"testing"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"go.bobheadxi.dev/streamline/pipe"
 	"go.bobheadxi.dev/streamline/pipeline"
 	"go.bobheadxi.dev/streamline/streamexec"
 )
@@ -88,4 +90,23 @@ and another line!`).Equal(t, out)
 		assert.NoError(t, err)
 		assert.Empty(t, out)
 	})
+	t.Run("StartWithOptions", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		cmd := exec.Command("bash", "-c", `for i in $(seq 1000); do echo "line $i"; done`)
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{
+			Pipe: pipe.Options{MemoryLimit: 64, FileChunkSize: 1024, TempDir: dir},
+		})
+		require.NoError(t, err)
+
+		lines, err := stream.Lines()
+		require.NoError(t, err)
+		assert.Len(t, lines, 1000)
+		assert.Equal(t, "line 1000", lines[999])
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
 }
@@ -0,0 +1,77 @@
+package streamexec
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"go.bobheadxi.dev/streamline"
+)
+
+// DefaultGracePeriod is the time commands started with StartContext are given to exit
+// after receiving SIGTERM if Options.GracePeriod is not set.
+const DefaultGracePeriod = 10 * time.Second
+
+// StartContext is the same as Start, but terminates the command when ctx is done. The
+// command is started in its own process group, so that when ctx is done, SIGTERM can be
+// sent to the command and any processes it started. If the command does not exit within
+// the grace period, the process group is killed with SIGKILL - see
+// Options.GracePeriod. On platforms without process groups, the command is killed
+// immediately.
+//
+// If the command is terminated, the Stream ends with an error that matches ctx.Err()
+// with errors.Is, typically an *ExitError with ExitError.ContextErr set.
+//
+// The command should be created with exec.Command rather than exec.CommandContext,
+// which would only kill the command itself when ctx is done.
+func StartContext(ctx context.Context, cmd *exec.Cmd, modes ...StreamMode) (*streamline.Stream, error) {
+	return StartContextWithOptions(ctx, cmd, Options{}, modes...)
+}
+
+// StartContextWithOptions is the same as StartContext, but configures the command and
+// its Stream with opts.
+func StartContextWithOptions(ctx context.Context, cmd *exec.Cmd, opts Options, modes ...StreamMode) (*streamline.Stream, error) {
+	setProcessGroup(cmd)
+	return start(ctx, cmd, opts, modes, nil)
+}
+
+// waitContext waits for cmd to exit, terminating its process group if ctx is done first.
+// If the process group was terminated, ctxErr is ctx.Err().
+func waitContext(ctx context.Context, cmd *exec.Cmd, grace time.Duration) (err, ctxErr error) {
+	if ctx.Done() == nil {
+		return cmd.Wait(), nil
+	}
+	if grace == 0 {
+		grace = DefaultGracePeriod
+	}
+
+	exited := make(chan struct{})
+	terminated := make(chan error, 1)
+	go func() {
+		defer close(terminated)
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		terminated <- ctx.Err()
+
+		if grace > 0 {
+			_ = signalGroup(cmd, false)
+			timer := time.NewTimer(grace)
+			defer timer.Stop()
+			select {
+			case <-exited:
+				return
+			case <-timer.C:
+			}
+		}
+		// The process group may still be holding output pipes open after the command
+		// itself has exited, so cmd.Wait might not return until it is killed.
+		_ = signalGroup(cmd, true)
+	}()
+
+	err = cmd.Wait()
+	close(exited)
+	return err, <-terminated
+}
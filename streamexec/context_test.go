@@ -0,0 +1,90 @@
+package streamexec_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.bobheadxi.dev/streamline/streamexec"
+)
+
+func TestStartContext(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("echo", "hello world")
+		stream, err := streamexec.StartContext(context.Background(), cmd)
+		require.NoError(t, err)
+
+		out, err := stream.String()
+		require.NoError(t, err)
+		autogold.Expect("hello world").Equal(t, out)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cmd := exec.Command("bash", "-c", `echo "started" ; sleep 30`)
+		stream, err := streamexec.StartContext(ctx, cmd)
+		require.NoError(t, err)
+
+		var lines []string
+		err = stream.Stream(func(line string) {
+			lines = append(lines, line)
+			cancel()
+		})
+		autogold.Expect([]string{"started"}).Equal(t, lines)
+		assert.True(t, errors.Is(err, context.Canceled))
+		autogold.Expect("context canceled: signal: terminated").Equal(t, err.Error())
+
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, syscall.SIGTERM, exitErr.Signal)
+	})
+
+	t.Run("grandchildren ignoring SIGTERM are killed", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		// The background sleep holds the output pipe open even after bash exits.
+		cmd := exec.Command("bash", "-c", `trap "" TERM ; sleep 30 & echo "started" ; wait`)
+		stream, err := streamexec.StartContextWithOptions(ctx, cmd, streamexec.Options{
+			GracePeriod: 100 * time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		start := time.Now()
+		out, err := stream.String()
+		assert.Less(t, time.Since(start), 10*time.Second)
+		autogold.Expect("started").Equal(t, out)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, syscall.SIGKILL, exitErr.Signal)
+	})
+
+	t.Run("already cancelled", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cmd := exec.Command("echo", "hello world")
+		stream, err := streamexec.StartContext(ctx, cmd)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, cmd.Process)
+
+		out, err := stream.String()
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+	})
+}
@@ -1,9 +1,12 @@
 package streamexec_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 
+	"go.bobheadxi.dev/streamline/pipeline"
 	"go.bobheadxi.dev/streamline/streamexec"
 )
 
@@ -41,3 +44,43 @@ func ExampleStart_errWithStderr() {
 	// got error: exit status 1: my stderr output
 	// got output: my stdout output
 }
+
+func ExampleStartSeparate() {
+	cmd := exec.Command("bash", "-c", `echo "my stdout output" ; >&2 echo "my stderr output"`)
+	streams, err := streamexec.StartSeparate(cmd)
+	if err != nil {
+		fmt.Println("failed to start: ", err.Error())
+	}
+
+	stdout, _ := streams.Stdout.String()
+	stderr, _ := streams.Stderr.String()
+	fmt.Println("got stdout:", stdout)
+	fmt.Println("got stderr:", stderr)
+	fmt.Println("exit error:", streams.Wait())
+	// Output:
+	// got stdout: my stdout output
+	// got stderr: my stderr output
+	// exit error: <nil>
+}
+
+func ExampleChain() {
+	stream, err := streamexec.Chain(context.Background(),
+		streamexec.Command(exec.Command("printf", `b\na\nb\nc\n`)),
+		streamexec.Pipeline(pipeline.Filter(func(line []byte) bool {
+			return !bytes.Equal(line, []byte("c"))
+		})),
+		streamexec.Command(exec.Command("sort")),
+		streamexec.Command(exec.Command("uniq")))
+	if err != nil {
+		fmt.Println("failed to start:", err.Error())
+	}
+
+	out, err := stream.String()
+	if err != nil {
+		fmt.Println("chain failed:", err.Error())
+	}
+	fmt.Println(out)
+	// Output:
+	// a
+	// b
+}
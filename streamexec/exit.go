@@ -0,0 +1,200 @@
+package streamexec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultStderrTailLines is the number of lines of stderr retained for ExitError if
+// Options.StderrTailLines is not set.
+const DefaultStderrTailLines = 10
+
+// maxStderrTailLineLength is the maximum length of each line retained for ExitError.
+// Longer lines are truncated.
+const maxStderrTailLineLength = 4096
+
+// ExitError is the error that commands started by this package end with when they exit
+// unsuccessfully, and can be retrieved from a Stream's error with errors.As:
+//
+//	_, err := stream.String()
+//	var exitErr *streamexec.ExitError
+//	if errors.As(err, &exitErr) {
+//		log.Printf("%v exited with code %d: %s", exitErr.Command, exitErr.ExitCode,
+//			strings.Join(exitErr.StderrTail, "\n"))
+//	}
+//
+// ExitError wraps the underlying *exec.ExitError, which can also be retrieved with
+// errors.As.
+type ExitError struct {
+	// Err is the error returned by cmd.Wait.
+	Err *exec.ExitError
+
+	// Command is the command line of the command, including the command itself.
+	Command []string
+	// ExitCode is the exit code of the command, or -1 if it was terminated by a signal.
+	ExitCode int
+	// Signal is the signal that terminated the command, if any.
+	Signal os.Signal
+
+	// WallTime is the time elapsed between starting the command and its exit.
+	WallTime time.Duration
+	// UserTime and SystemTime are the user and system CPU time of the command and its
+	// waited-for children.
+	UserTime, SystemTime time.Duration
+	// MaxRSS is the maximum resident set size of the command in bytes, if available on
+	// this platform.
+	MaxRSS int64
+
+	// StderrTail contains the last lines of the command's stderr output, bounded by
+	// Options.StderrTailLines. Very long lines are truncated.
+	StderrTail []string
+
+	// ContextErr is the error of the context that caused the command to be terminated,
+	// if the command was started with StartContext. ExitError matches ContextErr with
+	// errors.Is, so cancellation can be checked with errors.Is(err, context.Canceled).
+	ContextErr error
+}
+
+func (e *ExitError) Error() string {
+	if e.ContextErr != nil {
+		return e.ContextErr.Error() + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// Is reports whether target matches ContextErr.
+func (e *ExitError) Is(target error) bool {
+	return e.ContextErr != nil && errors.Is(e.ContextErr, target)
+}
+
+// exitError returns an *ExitError for err if it is an *exec.ExitError, and err as-is
+// otherwise. If ctxErr is set, the command was terminated because its context was done,
+// and the returned error is never nil. It must be called after cmd.Wait has returned.
+func exitError(cmd *exec.Cmd, err, ctxErr error, started time.Time, stderr *tailWriter) error {
+	var execErr *exec.ExitError
+	if !errors.As(err, &execErr) {
+		if ctxErr != nil {
+			// The command exited successfully after being signalled, or Wait failed for
+			// some other reason.
+			return ctxErr
+		}
+		return err
+	}
+	state := execErr.ProcessState
+	return &ExitError{
+		Err:        execErr,
+		Command:    cmd.Args,
+		ExitCode:   state.ExitCode(),
+		Signal:     exitSignal(state),
+		WallTime:   time.Since(started),
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+		StderrTail: stderr.Lines(),
+		ContextErr: ctxErr,
+	}
+}
+
+// attachTail attaches stderr to cmd.Stderr, if stderr is not nil.
+func attachTail(cmd *exec.Cmd, stderr *tailWriter) {
+	switch {
+	case stderr == nil:
+	case cmd.Stderr == nil:
+		cmd.Stderr = stderr
+	default:
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, stderr)
+	}
+}
+
+// withStderr wraps err with the stderr tail, if there is any.
+func withStderr(err error, stderr *tailWriter) error {
+	if lines := stderr.Lines(); len(lines) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.Join(lines, "\n"))
+	}
+	return err
+}
+
+// tailWriter retains the last lines written to it.
+type tailWriter struct {
+	max int
+
+	mux     sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+// newTailWriter returns a tailWriter configured by opts, or nil if stderr should not be
+// retained.
+func newTailWriter(opts Options) *tailWriter {
+	switch {
+	case opts.StderrTailLines < 0:
+		return nil
+	case opts.StderrTailLines == 0:
+		return &tailWriter{max: DefaultStderrTailLines}
+	default:
+		return &tailWriter{max: opts.StderrTailLines}
+	}
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.appendPartial(p)
+			break
+		}
+		t.appendPartial(p[:i])
+		t.push(string(t.partial))
+		t.partial = t.partial[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (t *tailWriter) appendPartial(p []byte) {
+	if room := maxStderrTailLineLength - len(t.partial); len(p) > room {
+		p = p[:room]
+	}
+	t.partial = append(t.partial, p...)
+}
+
+func (t *tailWriter) push(line string) {
+	if len(t.lines) < t.max {
+		t.lines = append(t.lines, line)
+		return
+	}
+	copy(t.lines, t.lines[1:])
+	t.lines[len(t.lines)-1] = line
+}
+
+// Lines returns the retained lines, including any trailing incomplete line. It is safe
+// to call on a nil tailWriter.
+func (t *tailWriter) Lines() []string {
+	if t == nil {
+		return nil
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+	if len(t.partial) > 0 {
+		lines = append(lines, string(t.partial))
+		if len(lines) > t.max {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
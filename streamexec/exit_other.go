@@ -0,0 +1,9 @@
+//go:build !unix
+
+package streamexec
+
+import "os"
+
+func exitSignal(*os.ProcessState) os.Signal { return nil }
+
+func maxRSS(*os.ProcessState) int64 { return 0 }
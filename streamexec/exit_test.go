@@ -0,0 +1,87 @@
+package streamexec_test
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.bobheadxi.dev/streamline/streamexec"
+)
+
+func TestExitError(t *testing.T) {
+	t.Run("exit code", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("bash", "-c", `echo "stdout" ; >&2 echo "stderr" ; exit 3`)
+		stream, err := streamexec.Start(cmd)
+		require.NoError(t, err)
+
+		_, err = stream.String()
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		autogold.Expect("exit status 3").Equal(t, exitErr.Error())
+		assert.Equal(t, 3, exitErr.ExitCode)
+		assert.Nil(t, exitErr.Signal)
+		assert.Equal(t, cmd.Args, exitErr.Command)
+		autogold.Expect([]string{"stderr"}).Equal(t, exitErr.StderrTail)
+		assert.Positive(t, exitErr.WallTime)
+		if runtime.GOOS == "linux" {
+			assert.Positive(t, exitErr.MaxRSS)
+		}
+
+		// The underlying error is also available.
+		var execErr *exec.ExitError
+		assert.True(t, errors.As(err, &execErr))
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("bash", "-c", `kill -TERM $$`)
+		stream, err := streamexec.Start(cmd)
+		require.NoError(t, err)
+
+		_, err = stream.String()
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, -1, exitErr.ExitCode)
+		assert.Equal(t, syscall.SIGTERM, exitErr.Signal)
+	})
+
+	t.Run("bounded stderr with ErrWithStderr", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("bash", "-c", `for i in $(seq 100); do >&2 echo "line $i"; done ; exit 1`)
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{StderrTailLines: 3},
+			streamexec.Stdout, streamexec.ErrWithStderr)
+		require.NoError(t, err)
+
+		_, err = stream.String()
+		autogold.Expect("exit status 1: line 98\nline 99\nline 100").Equal(t, err.Error())
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		autogold.Expect([]string{"line 98", "line 99", "line 100"}).Equal(t, exitErr.StderrTail)
+	})
+
+	t.Run("StartSeparate", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("bash", "-c", `>&2 printf "oh no" ; exit 2`)
+		streams, err := streamexec.StartSeparate(cmd)
+		require.NoError(t, err)
+
+		stderr, err := streams.Stderr.String()
+		autogold.Expect("oh no").Equal(t, stderr)
+		var exitErr *streamexec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, 2, exitErr.ExitCode)
+		autogold.Expect([]string{"oh no"}).Equal(t, exitErr.StderrTail)
+		assert.Equal(t, err, streams.Wait())
+	})
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package streamexec
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func exitSignal(state *os.ProcessState) os.Signal {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return nil
+}
+
+func maxRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || usage == nil {
+		return 0
+	}
+	// Maxrss is reported in bytes on Darwin, and in kilobytes elsewhere.
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
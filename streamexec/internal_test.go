@@ -1,6 +1,8 @@
 package streamexec
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -59,3 +61,19 @@ func TestModeSet(t *testing.T) {
 	}
 
 }
+
+func TestTailWriter(t *testing.T) {
+	w := &tailWriter{max: 2}
+	w.Write([]byte("foo\nba"))
+	assert.Equal(t, []string{"foo", "ba"}, w.Lines())
+	w.Write([]byte("r\nbaz\n"))
+	assert.Equal(t, []string{"bar", "baz"}, w.Lines())
+
+	// Long lines are truncated
+	w.Write(bytes.Repeat([]byte("a"), maxStderrTailLineLength+10))
+	w.Write([]byte("\n"))
+	assert.Equal(t, []string{"baz", strings.Repeat("a", maxStderrTailLineLength)}, w.Lines())
+
+	var nilWriter *tailWriter
+	assert.Nil(t, nilWriter.Lines())
+}
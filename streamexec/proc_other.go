@@ -0,0 +1,11 @@
+//go:build !unix
+
+package streamexec
+
+import "os/exec"
+
+func setProcessGroup(*exec.Cmd) {}
+
+// signalGroup kills cmd, since processes cannot be signalled gracefully or in groups on
+// this platform.
+func signalGroup(cmd *exec.Cmd, _ bool) error { return cmd.Process.Kill() }
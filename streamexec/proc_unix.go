@@ -0,0 +1,30 @@
+//go:build unix
+
+package streamexec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup configures cmd to start in its own process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// A new session also has its own process group.
+	if !cmd.SysProcAttr.Setsid {
+		cmd.SysProcAttr.Setpgid = true
+		cmd.SysProcAttr.Pgid = 0
+	}
+}
+
+// signalGroup sends SIGTERM, or SIGKILL if kill is true, to the process group of cmd.
+func signalGroup(cmd *exec.Cmd, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	// The process group ID is the same as the ID of the process that created it.
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
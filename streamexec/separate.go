@@ -0,0 +1,85 @@
+package streamexec
+
+import (
+	"os/exec"
+	"time"
+
+	"go.bobheadxi.dev/streamline"
+	"go.bobheadxi.dev/streamline/pipe"
+)
+
+// Streams holds separate Streams for the output of a command started with
+// StartSeparate.
+type Streams struct {
+	// Stdout streams the command's stdout.
+	Stdout *streamline.Stream
+	// Stderr streams the command's stderr.
+	Stderr *streamline.Stream
+
+	done chan struct{}
+	err  error
+}
+
+// Wait blocks until the command has exited and all its output has been written to the
+// Streams, and returns the command's exit error, if any. It does not wait for the Streams
+// to be read.
+func (s *Streams) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// StartSeparate attaches separate Streams to the command's stdout and stderr and starts
+// it. It returns an error if the command fails to start. If the command successfully
+// starts, it also starts a goroutine that waits for command completion and stops the
+// pipes appropriately.
+//
+// Both Streams end with the command's exit error, if any, which is also returned by
+// Streams.Wait - see ExitError. The Streams can be consumed independently, for example
+// with different pipelines, and neither Stream needs to be read for the command to make
+// progress: by default, output is piped through unbounded buffers created by
+// streamline/pipe.NewStream(...) that overflow onto disk, so the command can never block
+// on writing output that has not been read yet. If limits are configured with
+// StartSeparateWithOptions, both Streams should be read concurrently.
+func StartSeparate(cmd *exec.Cmd) (*Streams, error) {
+	return StartSeparateWithOptions(cmd, Options{})
+}
+
+// StartSeparateWithOptions is the same as StartSeparate, but configures the command and
+// its Streams with opts. The pipe options apply to each Stream.
+func StartSeparateWithOptions(cmd *exec.Cmd, opts Options) (*Streams, error) {
+	stdoutWriter, stdout := pipe.NewStreamWithOptions(opts.Pipe)
+	stderrWriter, stderr := pipe.NewStreamWithOptions(opts.Pipe)
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	stderrTail := newTailWriter(opts)
+	attachTail(cmd, stderrTail)
+
+	streams := &Streams{
+		Stdout: stdout,
+		Stderr: stderr,
+		done:   make(chan struct{}),
+	}
+
+	// Start running the command in the background.
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		// Close pipes to let streams exit gracefully if used
+		stdoutWriter.CloseWithError(nil)
+		stderrWriter.CloseWithError(nil)
+		streams.err = err
+		close(streams.done)
+		return streams, err
+	}
+
+	// Wait for the command to complete in the background so we can propagate the error
+	// back to the streams. cmd.Wait only returns once all output has been copied.
+	go func() {
+		err := exitError(cmd, cmd.Wait(), nil, started, stderrTail)
+		stdoutWriter.CloseWithError(err)
+		stderrWriter.CloseWithError(err)
+		streams.err = err
+		close(streams.done)
+	}()
+
+	return streams, nil
+}
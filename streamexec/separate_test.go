@@ -0,0 +1,77 @@
+package streamexec_test
+
+import (
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.bobheadxi.dev/streamline/jq"
+	"go.bobheadxi.dev/streamline/streamexec"
+)
+
+func TestStartSeparate(t *testing.T) {
+	t.Run("independent streams", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("bash", "-c", `
+			echo '{"msg":"hello"}'
+			>&2 echo "starting"
+			echo '{"msg":"world"}'
+			>&2 echo "done"
+			exit 1`)
+		streams, err := streamexec.StartSeparate(cmd)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var stdout, stderr []string
+		var stdoutErr, stderrErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			stdout, stdoutErr = streams.Stdout.WithPipeline(jq.Pipeline(".msg", jq.WithRawOutput())).Lines()
+		}()
+		go func() {
+			defer wg.Done()
+			stderr, stderrErr = streams.Stderr.Lines()
+		}()
+		wg.Wait()
+
+		autogold.Expect([]string{"hello", "world"}).Equal(t, stdout)
+		autogold.Expect([]string{"starting", "done"}).Equal(t, stderr)
+		for _, err := range []error{stdoutErr, stderrErr, streams.Wait()} {
+			require.Error(t, err)
+			assert.Equal(t, "exit status 1", err.Error())
+		}
+	})
+
+	t.Run("unread stream does not block", func(t *testing.T) {
+		t.Parallel()
+
+		// Write more than a typical OS pipe buffer to stderr
+		cmd := exec.Command("bash", "-c", `head -c 1000000 /dev/zero | tr '\0' 'a' >&2 ; echo "stdout"`)
+		streams, err := streamexec.StartSeparate(cmd)
+		require.NoError(t, err)
+
+		out, err := streams.Stdout.String()
+		require.NoError(t, err)
+		assert.Equal(t, "stdout", out)
+		assert.NoError(t, streams.Wait())
+	})
+
+	t.Run("failed to start", func(t *testing.T) {
+		t.Parallel()
+
+		streams, err := streamexec.StartSeparate(exec.Command("foobar"))
+		assert.Error(t, err)
+		require.NotNil(t, streams)
+		assert.Equal(t, err, streams.Wait())
+
+		out, err := streams.Stderr.String()
+		assert.NoError(t, err)
+		assert.Empty(t, out)
+	})
+}
@@ -0,0 +1,107 @@
+package streamexec
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"go.bobheadxi.dev/streamline"
+)
+
+// errStopped is returned by a stoppableWriter that has been stopped.
+var errStopped = errors.New("output no longer consumed")
+
+// stoppableWriter discards writes with an error after it has been stopped. When a
+// command's output is written to a stopped writer, os/exec closes the command's end of
+// the output pipe, so that the command receives SIGPIPE on its next write, like it would
+// in a shell pipeline.
+type stoppableWriter struct {
+	w       io.Writer
+	stopped atomic.Bool
+}
+
+func (w *stoppableWriter) Write(p []byte) (int, error) {
+	if w.stopped.Load() {
+		return 0, errStopped
+	}
+	return w.w.Write(p)
+}
+
+func (w *stoppableWriter) stop() { w.stopped.Store(true) }
+
+// stdinCopier copies a Stream into a command's stdin.
+type stdinCopier struct {
+	input *streamline.Stream
+	stdin io.WriteCloser
+	// stage is set if the command is part of a Chain.
+	stage *chainStage
+
+	// done is closed once err is set.
+	done chan struct{}
+	err  error
+}
+
+func newStdinCopier(input *streamline.Stream, stdin io.WriteCloser, stage *chainStage) *stdinCopier {
+	return &stdinCopier{
+		input: input,
+		stdin: stdin,
+		stage: stage,
+		done:  make(chan struct{}),
+	}
+}
+
+// copy writes the input to stdin until the input ends, or until the command stops
+// accepting input.
+func (c *stdinCopier) copy() {
+	w := &stdinWriter{w: c.stdin}
+	_, err := c.input.WriteTo(w)
+	if w.err != nil {
+		// The command exited or closed its stdin without consuming all input, which is
+		// not an error.
+		err = nil
+	}
+	c.err = err
+	// Indicate completion before closing stdin, so that result knows all input was
+	// consumed if the command exits when it reaches the end of its input.
+	close(c.done)
+	_ = c.stdin.Close()
+
+	if w.err != nil || err != nil {
+		c.stopUpstream()
+		// The rest of the input will not be read, so release its resources.
+		_ = c.input.Close()
+	}
+}
+
+// result returns the error from reading the input, if any. It must be called after the
+// command has exited. If the command exited before all input was read, result returns
+// nil and stops the upstream stage, if there is one.
+func (c *stdinCopier) result() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		c.stopUpstream()
+		return nil
+	}
+}
+
+func (c *stdinCopier) stopUpstream() {
+	if c.stage != nil && c.stage.upstream != nil {
+		c.stage.upstream.stop()
+	}
+}
+
+// stdinWriter records errors from writing to a command's stdin.
+type stdinWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *stdinWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,104 @@
+package streamexec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.bobheadxi.dev/streamline"
+)
+
+// TagFormat indicates how each line of output is tagged with its source, configured with
+// Options.Tag.
+type TagFormat int
+
+const (
+	// TagNone does not tag output. It is the default.
+	TagNone TagFormat = iota
+	// TagPrefix prefixes each line with Options.StdoutPrefix or Options.StderrPrefix.
+	TagPrefix
+	// TagJSON wraps each line in a JSON object with the fields "source", which is either
+	// "stdout" or "stderr", and "line". Tagged lines can be consumed with StreamTagged,
+	// or with JSON tooling such as streamline/jq.
+	TagJSON
+)
+
+const (
+	// DefaultStdoutPrefix is the prefix used for stdout lines by TagPrefix if
+	// Options.StdoutPrefix is not set.
+	DefaultStdoutPrefix = "[stdout] "
+	// DefaultStderrPrefix is the prefix used for stderr lines by TagPrefix if
+	// Options.StderrPrefix is not set.
+	DefaultStderrPrefix = "[stderr] "
+)
+
+// taggedLine is the format of lines tagged with TagJSON.
+type taggedLine struct {
+	Source string `json:"source"`
+	Line   string `json:"line"`
+}
+
+func sourceName(source StreamMode) string {
+	if source == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// tagger returns a function that tags lines from source, or nil if lines should not be
+// tagged.
+func (o Options) tagger(source StreamMode) func(line []byte) []byte {
+	switch o.Tag {
+	case TagPrefix:
+		prefix := o.StdoutPrefix
+		if prefix == "" {
+			prefix = DefaultStdoutPrefix
+		}
+		if source == Stderr {
+			prefix = o.StderrPrefix
+			if prefix == "" {
+				prefix = DefaultStderrPrefix
+			}
+		}
+		p := []byte(prefix)
+		return func(line []byte) []byte { return append(p[:len(p):len(p)], line...) }
+
+	case TagJSON:
+		name := sourceName(source)
+		return func(line []byte) []byte {
+			// Marshalling strings never fails, and escapes any newlines.
+			tagged, _ := json.Marshal(taggedLine{Source: name, Line: string(line)})
+			return tagged
+		}
+
+	default:
+		return nil
+	}
+}
+
+// StreamTagged consumes a Stream of output tagged with TagJSON, calling dst with the
+// source of each line, either Stdout or Stderr, and its original content. It returns an
+// error if the Stream returns an error or if any line is not a line tagged with TagJSON.
+//
+//	stream, _ := streamexec.StartWithOptions(cmd, streamexec.Options{Tag: streamexec.TagJSON})
+//	err := streamexec.StreamTagged(stream, func(source streamexec.StreamMode, line string) {
+//		if source == streamexec.Stderr {
+//			log.Println("error output:", line)
+//		}
+//	})
+func StreamTagged(stream *streamline.Stream, dst func(source StreamMode, line string)) error {
+	return stream.StreamBytes(func(line []byte) error {
+		var tagged taggedLine
+		if err := json.Unmarshal(line, &tagged); err != nil {
+			return fmt.Errorf("invalid tagged line %q: %w", line, err)
+		}
+		switch tagged.Source {
+		case "stdout":
+			dst(Stdout, tagged.Line)
+		case "stderr":
+			dst(Stderr, tagged.Line)
+		default:
+			return fmt.Errorf("invalid tagged line %q: unknown source %q", line, tagged.Source)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package streamexec_test
+
+import (
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hexops/autogold/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.bobheadxi.dev/streamline/streamexec"
+)
+
+func TestTag(t *testing.T) {
+	const script = `echo "stdout 1" ; sleep 0.01 ; >&2 echo "stderr 1" ; sleep 0.01 ; echo "stdout 2" ; sleep 0.01 ; >&2 printf "partial"`
+
+	for _, tc := range []struct {
+		name string
+		opts streamexec.Options
+		want autogold.Value
+	}{
+		{
+			name: "TagPrefix",
+			opts: streamexec.Options{Tag: streamexec.TagPrefix},
+			want: autogold.Expect([]string{
+				"[stderr] partial", "[stderr] stderr 1", "[stdout] stdout 1",
+				"[stdout] stdout 2",
+			}),
+		},
+		{
+			name: "TagPrefix with custom prefixes",
+			opts: streamexec.Options{Tag: streamexec.TagPrefix, StdoutPrefix: "out| ", StderrPrefix: "err| "},
+			want: autogold.Expect([]string{
+				"err| partial", "err| stderr 1", "out| stdout 1",
+				"out| stdout 2",
+			}),
+		},
+		{
+			name: "TagJSON",
+			opts: streamexec.Options{Tag: streamexec.TagJSON},
+			want: autogold.Expect([]string{
+				`{"source":"stderr","line":"partial"}`,
+				`{"source":"stderr","line":"stderr 1"}`,
+				`{"source":"stdout","line":"stdout 1"}`,
+				`{"source":"stdout","line":"stdout 2"}`,
+			}),
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := exec.Command("bash", "-c", script)
+			stream, err := streamexec.StartWithOptions(cmd, tc.opts)
+			require.NoError(t, err)
+
+			lines, err := stream.Lines()
+			require.NoError(t, err)
+			// Ordering between stdout and stderr is not guaranteed, since they are
+			// written through separate pipes.
+			sort.Strings(lines)
+			tc.want.Equal(t, lines)
+		})
+	}
+
+	t.Run("lines are not interleaved", func(t *testing.T) {
+		t.Parallel()
+
+		// Write lines in many small chunks from both outputs concurrently.
+		cmd := exec.Command("bash", "-c", `
+			(for i in $(seq 200); do printf "o" ; printf "ut\n" ; done) &
+			(for i in $(seq 200); do >&2 printf "e" ; >&2 printf "rr\n" ; done) &
+			wait`)
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{Tag: streamexec.TagPrefix})
+		require.NoError(t, err)
+
+		lines, err := stream.Lines()
+		require.NoError(t, err)
+		assert.Len(t, lines, 400)
+		for _, l := range lines {
+			if l != "[stdout] out" && l != "[stderr] err" {
+				t.Errorf("unexpected line %q", l)
+			}
+		}
+	})
+
+	t.Run("StreamTagged", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("bash", "-c", script+` ; exit 1`)
+		stream, err := streamexec.StartWithOptions(cmd, streamexec.Options{Tag: streamexec.TagJSON})
+		require.NoError(t, err)
+
+		var stdout, stderr []string
+		err = streamexec.StreamTagged(stream, func(source streamexec.StreamMode, line string) {
+			switch source {
+			case streamexec.Stdout:
+				stdout = append(stdout, line)
+			case streamexec.Stderr:
+				stderr = append(stderr, line)
+			}
+		})
+		require.Error(t, err)
+		autogold.Expect("exit status 1").Equal(t, err.Error())
+		autogold.Expect([]string{"stdout 1", "stdout 2"}).Equal(t, stdout)
+		autogold.Expect([]string{"stderr 1", "partial"}).Equal(t, stderr)
+	})
+
+	t.Run("StreamTagged with untagged output", func(t *testing.T) {
+		t.Parallel()
+
+		cmd := exec.Command("echo", "hello world")
+		stream, err := streamexec.Start(cmd)
+		require.NoError(t, err)
+
+		err = streamexec.StreamTagged(stream, func(streamexec.StreamMode, string) {})
+		require.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), `invalid tagged line "hello world"`))
+	})
+}